@@ -33,4 +33,8 @@ func Test_fibonacci(t *testing.T) {
 		require.Equal(t, wasm.ValueTypeI32, retTypes[0])
 		require.Equal(t, c.exp, int32(ret[0]))
 	}
+
+	var fibonacci func(int32) int32
+	require.NoError(t, vm.ExportedFunc("fibonacci", &fibonacci))
+	require.Equal(t, int32(6765), fibonacci(20))
 }
@@ -2,11 +2,14 @@ package hostfunc
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 
 	"github.com/mathetake/gasm/wasm"
 )
 
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
 type ModuleBuilder struct {
 	modules map[string]*wasm.Module
 }
@@ -29,31 +32,149 @@ func (m *ModuleBuilder) MustSetFunction(modName, funcName string, fn func(machin
 	}
 }
 
+// SetFunction registers the function returned by fn under modName.funcName. The function may
+// return an error as its last result; a non-nil error aborts the guest execution and is returned
+// from the virtual machine's call as a *wasm.HostError.
 func (m *ModuleBuilder) SetFunction(modName, funcName string, fn func(machine *wasm.VirtualMachine) reflect.Value) error {
+	sig, err := getSignature(fn(&wasm.VirtualMachine{}).Type())
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+
+	m.addFunction(modName, funcName, &wasm.HostFunction{
+		ClosureGenerator: fn,
+		Signature:        sig,
+	})
+	return nil
+}
+
+func (m *ModuleBuilder) MustSetRawFunction(modName, funcName string, sig *wasm.FunctionType,
+	fn func(vm *wasm.VirtualMachine, params []uint64, results []uint64) error) {
+	if err := m.SetRawFunction(modName, funcName, sig, fn); err != nil {
+		panic(err)
+	}
+}
+
+// SetRawFunction registers a host function which bypasses reflection: it receives the parameters
+// and writes the results as raw values according to the explicitly declared signature.
+func (m *ModuleBuilder) SetRawFunction(modName, funcName string, sig *wasm.FunctionType,
+	fn func(vm *wasm.VirtualMachine, params []uint64, results []uint64) error) error {
+	if sig == nil {
+		return fmt.Errorf("signature must be given")
+	} else if fn == nil {
+		return fmt.Errorf("function must be given")
+	}
 
+	m.addFunction(modName, funcName, &wasm.RawHostFunction{
+		Signature: sig,
+		Function:  fn,
+	})
+	return nil
+}
+
+func (m *ModuleBuilder) MustSetMemory(modName, name string, min uint32, max *uint32) *wasm.Memory {
+	mem, err := m.SetMemory(modName, name, min, max)
+	if err != nil {
+		panic(err)
+	}
+	return mem
+}
+
+// SetMemory exports a memory of min pages, which can grow up to max pages if given.
+// The returned memory is shared with the modules importing it.
+func (m *ModuleBuilder) SetMemory(modName, name string, min uint32, max *uint32) (*wasm.Memory, error) {
+	if err := validateLimits(min, max, wasm.MaxMemoryPages); err != nil {
+		return nil, err
+	}
+
+	mem := wasm.NewMemory(min, max)
+	mod := m.module(modName)
+	addExport(mod, name, wasm.ExportKindMem, len(mod.IndexSpace.Memory))
+	mod.IndexSpace.Memory = append(mod.IndexSpace.Memory, mem)
+	return mem, nil
+}
+
+func (m *ModuleBuilder) MustSetTable(modName, name string, min uint32, max *uint32) *wasm.Table {
+	table, err := m.SetTable(modName, name, min, max)
+	if err != nil {
+		panic(err)
+	}
+	return table
+}
+
+// SetTable exports a table of min uninitialized elements.
+// The returned table is shared with the modules importing it.
+func (m *ModuleBuilder) SetTable(modName, name string, min uint32, max *uint32) (*wasm.Table, error) {
+	if err := validateLimits(min, max, math.MaxUint32); err != nil {
+		return nil, err
+	}
+
+	table := wasm.NewTable(min, max)
+	mod := m.module(modName)
+	addExport(mod, name, wasm.ExportKindTable, len(mod.IndexSpace.Table))
+	mod.IndexSpace.Table = append(mod.IndexSpace.Table, table)
+	return table, nil
+}
+
+func (m *ModuleBuilder) MustSetGlobal(modName, name string, v wasm.Value, mutable bool) *wasm.Global {
+	g, err := m.SetGlobal(modName, name, v, mutable)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// SetGlobal exports a global initialized with v. The returned global is shared
+// with the modules importing it, so writes to a mutable global are visible to them.
+func (m *ModuleBuilder) SetGlobal(modName, name string, v wasm.Value, mutable bool) (*wasm.Global, error) {
+	switch v.Type() {
+	case wasm.ValueTypeI32, wasm.ValueTypeI64, wasm.ValueTypeF32, wasm.ValueTypeF64,
+		wasm.ValueTypeFuncref, wasm.ValueTypeExternref:
+	default:
+		return nil, fmt.Errorf("invalid value type: %#x", v.Type())
+	}
+
+	g := &wasm.Global{
+		Type: &wasm.GlobalType{Value: v.Type(), Mutable: mutable},
+		Val:  v.Raw(),
+	}
+	mod := m.module(modName)
+	addExport(mod, name, wasm.ExportKindGlobal, len(mod.IndexSpace.Globals))
+	mod.IndexSpace.Globals = append(mod.IndexSpace.Globals, g)
+	return g, nil
+}
+
+func (m *ModuleBuilder) addFunction(modName, funcName string, f wasm.VirtualMachineFunction) {
+	mod := m.module(modName)
+	addExport(mod, funcName, wasm.ExportKindFunction, len(mod.IndexSpace.Function))
+	mod.IndexSpace.Function = append(mod.IndexSpace.Function, f)
+}
+
+// module returns the module of the given name, creating it if it doesn't exist yet.
+func (m *ModuleBuilder) module(modName string) *wasm.Module {
 	mod, ok := m.modules[modName]
 	if !ok {
 		mod = &wasm.Module{IndexSpace: new(wasm.ModuleIndexSpace), SecExports: map[string]*wasm.ExportSegment{}}
 		m.modules[modName] = mod
 	}
+	return mod
+}
 
-	mod.SecExports[funcName] = &wasm.ExportSegment{
-		Name: funcName,
-		Desc: &wasm.ExportDesc{
-			Kind:  wasm.ExportKindFunction,
-			Index: uint32(len(mod.IndexSpace.Function)),
-		},
+func addExport(mod *wasm.Module, name string, kind byte, index int) {
+	mod.SecExports[name] = &wasm.ExportSegment{
+		Name: name,
+		Desc: &wasm.ExportDesc{Kind: kind, Index: uint32(index)},
 	}
+}
 
-	sig, err := getSignature(fn(&wasm.VirtualMachine{}).Type())
-	if err != nil {
-		return fmt.Errorf("invalid signature: %w", err)
+func validateLimits(min uint32, max *uint32, limit uint64) error {
+	if uint64(min) > limit {
+		return fmt.Errorf("minimum %d exceeds the limit of %d", min, limit)
+	} else if max != nil && *max < min {
+		return fmt.Errorf("maximum %d is less than the minimum %d", *max, min)
+	} else if max != nil && uint64(*max) > limit {
+		return fmt.Errorf("maximum %d exceeds the limit of %d", *max, limit)
 	}
-
-	mod.IndexSpace.Function = append(mod.IndexSpace.Function, &wasm.HostFunction{
-		ClosureGenerator: fn,
-		Signature:        sig,
-	})
 	return nil
 }
 
@@ -67,7 +188,13 @@ func getSignature(p reflect.Type) (*wasm.FunctionType, error) {
 		}
 	}
 
-	out := make([]wasm.ValueType, p.NumOut())
+	numOut := p.NumOut()
+	if numOut > 0 && p.Out(numOut-1) == errorType {
+		// errors are returned to the host and not visible to wasm
+		numOut--
+	}
+
+	out := make([]wasm.ValueType, numOut)
 	for i := range out {
 		out[i], err = getTypeOf(p.Out(i).Kind())
 		if err != nil {
@@ -78,16 +205,5 @@ func getSignature(p reflect.Type) (*wasm.FunctionType, error) {
 }
 
 func getTypeOf(kind reflect.Kind) (wasm.ValueType, error) {
-	switch kind {
-	case reflect.Float64:
-		return wasm.ValueTypeF64, nil
-	case reflect.Float32:
-		return wasm.ValueTypeF32, nil
-	case reflect.Int32, reflect.Uint32:
-		return wasm.ValueTypeI32, nil
-	case reflect.Int64, reflect.Uint64:
-		return wasm.ValueTypeI64, nil
-	default:
-		return 0x00, fmt.Errorf("invalid type: %s", kind.String())
-	}
+	return wasm.ValueTypeOf(kind)
 }
@@ -58,6 +58,166 @@ func TestModuleBuilder_SetFunction(t *testing.T) {
 	})
 }
 
+func TestModuleBuilder_SetRawFunction(t *testing.T) {
+	sig := &wasm.FunctionType{
+		InputTypes:  []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32},
+		ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32},
+	}
+
+	builder := NewModuleBuilder()
+	builder.MustSetFunction("env", "foo", func(machine *wasm.VirtualMachine) reflect.Value {
+		return reflect.ValueOf(func() {})
+	})
+	builder.MustSetRawFunction("env", "add", sig, func(_ *wasm.VirtualMachine, params, results []uint64) error {
+		results[0] = uint64(uint32(params[0]) + uint32(params[1]))
+		return nil
+	})
+	require.Error(t, builder.SetRawFunction("env", "bar", nil, func(*wasm.VirtualMachine, []uint64, []uint64) error {
+		return nil
+	}))
+	require.Error(t, builder.SetRawFunction("env", "bar", sig, nil))
+
+	ms := builder.Done()
+	e, ok := ms["env"].SecExports["add"]
+	require.True(t, ok)
+	require.Equal(t, uint32(1), e.Desc.Index)
+	_, ok = ms["env"].SecExports["bar"]
+	require.False(t, ok)
+
+	vm := newImportingVM(t, ms, sig, "add")
+	ret, _, err := vm.ExecExportedFunction("add", 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{3}, ret)
+	require.Equal(t, -1, vm.OperandStack.SP)
+}
+
+func TestModuleBuilder_SetMemoryTableGlobal(t *testing.T) {
+	builder := NewModuleBuilder()
+	max := uint32(4)
+	mem := builder.MustSetMemory("env", "memory", 2, &max)
+	table := builder.MustSetTable("env", "__indirect_function_table", 1, nil)
+	sp := builder.MustSetGlobal("env", "__stack_pointer", wasm.I32(1024), true)
+
+	_, err := builder.SetMemory("env", "invalid", 5, &max)
+	require.Error(t, err)
+	_, err = builder.SetMemory("env", "invalid", wasm.MaxMemoryPages+1, nil)
+	require.Error(t, err)
+	_, err = builder.SetTable("env", "invalid", 5, &max)
+	require.Error(t, err)
+	_, err = builder.SetGlobal("env", "invalid", wasm.Value{}, false)
+	require.Error(t, err)
+
+	ms := builder.Done()
+	for name, exp := range map[string]*wasm.ExportDesc{
+		"memory":                    {Kind: wasm.ExportKindMem},
+		"__indirect_function_table": {Kind: wasm.ExportKindTable},
+		"__stack_pointer":           {Kind: wasm.ExportKindGlobal},
+	} {
+		e, ok := ms["env"].SecExports[name]
+		require.True(t, ok)
+		require.Equal(t, exp, e.Desc)
+	}
+	_, ok := ms["env"].SecExports["invalid"]
+	require.False(t, ok)
+
+	typeIdx := uint32(0)
+	m := &wasm.Module{
+		SecTypes: []*wasm.FunctionType{{ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}}},
+		SecImports: []*wasm.ImportSegment{
+			{Module: "env", Name: "memory", Desc: &wasm.ImportDesc{
+				Kind: wasm.ExportKindMem, MemTypePtr: &wasm.MemoryType{Min: 1},
+			}},
+			{Module: "env", Name: "__indirect_function_table", Desc: &wasm.ImportDesc{
+				Kind: wasm.ExportKindTable, TableTypePtr: &wasm.TableType{Limit: &wasm.LimitsType{Min: 1}},
+			}},
+			{Module: "env", Name: "__stack_pointer", Desc: &wasm.ImportDesc{
+				Kind: wasm.ExportKindGlobal, GlobalTypePtr: &wasm.GlobalType{Value: wasm.ValueTypeI32, Mutable: true},
+			}},
+		},
+		SecFunctions: []uint32{typeIdx, typeIdx},
+		SecCodes: []*wasm.CodeSegment{
+			{Body: []byte{byte(wasm.OptCodeGlobalGet), 0x00}},
+			{Body: []byte{byte(wasm.OptCodeMemorySize), 0x00}},
+		},
+		SecExports: map[string]*wasm.ExportSegment{
+			"sp":   {Name: "sp", Desc: &wasm.ExportDesc{Kind: wasm.ExportKindFunction, Index: 0}},
+			"size": {Name: "size", Desc: &wasm.ExportDesc{Kind: wasm.ExportKindFunction, Index: 1}},
+		},
+	}
+	vm, err := wasm.NewVM(m, ms)
+	require.NoError(t, err)
+	require.Same(t, mem, vm.Memory)
+	require.Same(t, table, vm.InnerModule.IndexSpace.Table[0])
+	require.Same(t, sp, vm.Globals[0])
+
+	sp.Val = 2048
+	ret, _, err := vm.ExecExportedFunction("sp")
+	require.NoError(t, err)
+	require.Equal(t, []uint64{2048}, ret)
+
+	_, ok = mem.Grow(1)
+	require.True(t, ok)
+	ret, _, err = vm.ExecExportedFunction("size")
+	require.NoError(t, err)
+	require.Equal(t, []uint64{3}, ret)
+}
+
+// newImportingVM instantiates a module which imports the function env.funcName and re-exports it.
+func newImportingVM(t testing.TB, modules map[string]*wasm.Module, sig *wasm.FunctionType, funcName string) *wasm.VirtualMachine {
+	idx := uint32(0)
+	m := &wasm.Module{
+		SecTypes: []*wasm.FunctionType{sig},
+		SecImports: []*wasm.ImportSegment{{
+			Module: "env", Name: funcName,
+			Desc: &wasm.ImportDesc{Kind: wasm.ExportKindFunction, TypeIndexPtr: &idx},
+		}},
+		SecExports: map[string]*wasm.ExportSegment{
+			funcName: {Name: funcName, Desc: &wasm.ExportDesc{Kind: wasm.ExportKindFunction, Index: 0}},
+		},
+	}
+	vm, err := wasm.NewVM(m, modules)
+	require.NoError(t, err)
+	return vm
+}
+
+func BenchmarkHostFunction_Call(b *testing.B) {
+	sig := &wasm.FunctionType{
+		InputTypes:  []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32},
+		ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32},
+	}
+
+	b.Run("reflect", func(b *testing.B) {
+		builder := NewModuleBuilder()
+		builder.MustSetFunction("env", "add", func(*wasm.VirtualMachine) reflect.Value {
+			return reflect.ValueOf(func(x, y uint32) uint32 { return x + y })
+		})
+		benchmarkHostFunctionCall(b, newImportingVM(b, builder.Done(), sig, "add"))
+	})
+
+	b.Run("raw", func(b *testing.B) {
+		builder := NewModuleBuilder()
+		builder.MustSetRawFunction("env", "add", sig, func(_ *wasm.VirtualMachine, params, results []uint64) error {
+			results[0] = uint64(uint32(params[0]) + uint32(params[1]))
+			return nil
+		})
+		benchmarkHostFunctionCall(b, newImportingVM(b, builder.Done(), sig, "add"))
+	})
+}
+
+func benchmarkHostFunctionCall(b *testing.B, vm *wasm.VirtualMachine) {
+	f := vm.Functions[0]
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vm.OperandStack.Push(1)
+		vm.OperandStack.Push(2)
+		f.Call(vm)
+		if vm.OperandStack.Pop() != 3 {
+			b.Fatal("unexpected result")
+		}
+	}
+}
+
 func Test_getSignature(t *testing.T) {
 	v := reflect.ValueOf(func(int32, int64, float32, float64) (int32, float64) { return 0, 0 })
 	actual, err := getSignature(v.Type())
@@ -68,6 +228,20 @@ func Test_getSignature(t *testing.T) {
 	}, actual)
 }
 
+func Test_getSignature_error(t *testing.T) {
+	v := reflect.ValueOf(func(int32) (int64, error) { return 0, nil })
+	actual, err := getSignature(v.Type())
+	require.NoError(t, err)
+	require.Equal(t, &wasm.FunctionType{
+		InputTypes:  []wasm.ValueType{wasm.ValueTypeI32},
+		ReturnTypes: []wasm.ValueType{wasm.ValueTypeI64},
+	}, actual)
+
+	v = reflect.ValueOf(func() (error, int32) { return nil, 0 })
+	_, err = getSignature(v.Type())
+	require.Error(t, err)
+}
+
 func Test_getTypeOf(t *testing.T) {
 	for _, c := range []struct {
 		kind reflect.Kind
@@ -0,0 +1,128 @@
+package wasi
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/mathetake/gasm/wasm"
+)
+
+// ClockID identifies a WASI clock.
+type ClockID uint32
+
+const (
+	ClockRealtime ClockID = iota
+	ClockMonotonic
+	ClockProcessCPUTime
+	ClockThreadCPUTime
+)
+
+// Clock is the source of time for clock_time_get and clock_res_get.
+type Clock interface {
+	// Time returns the current time of the clock in nanoseconds.
+	// ok is false if the clock is not supported.
+	Time(id ClockID) (ns uint64, ok bool)
+	// Resolution returns the resolution of the clock in nanoseconds.
+	// ok is false if the clock is not supported.
+	Resolution(id ClockID) (ns uint64, ok bool)
+}
+
+// WithClock sets the clock used by clock_time_get and clock_res_get.
+// It defaults to the time package, which doesn't provide the CPU time clocks: they return
+// EINVAL unless a Clock supporting them is set.
+func WithClock(c Clock) Option {
+	return func(w *WASI) {
+		w.clock = c
+	}
+}
+
+type systemClock struct {
+	start time.Time
+}
+
+func newSystemClock() *systemClock {
+	return &systemClock{start: time.Now()}
+}
+
+func (c *systemClock) Time(id ClockID) (uint64, bool) {
+	switch id {
+	case ClockRealtime:
+		return uint64(time.Now().UnixNano()), true
+	case ClockMonotonic:
+		// time.Since uses the monotonic clock reading
+		return uint64(time.Since(c.start)), true
+	default:
+		return 0, false
+	}
+}
+
+func (c *systemClock) Resolution(id ClockID) (uint64, bool) {
+	switch id {
+	case ClockRealtime:
+		return uint64(time.Microsecond), true
+	case ClockMonotonic:
+		return 1, true
+	default:
+		return 0, false
+	}
+}
+
+func (w *WASI) clock_res_get(vm *wasm.VirtualMachine) reflect.Value {
+	body := func(id uint32, resultPtr uint32) (err uint32) {
+		res, ok := w.clock.Resolution(ClockID(id))
+		if !ok {
+			return EINVAL
+		}
+
+		if !vm.Memory.WriteUint64Le(resultPtr, res) {
+			return EFAULT
+		}
+		return ESUCCESS
+	}
+	return reflect.ValueOf(body)
+}
+
+func (w *WASI) clock_time_get(vm *wasm.VirtualMachine) reflect.Value {
+	body := func(id uint32, precision uint64, resultPtr uint32) (err uint32) {
+		t, ok := w.clock.Time(ClockID(id))
+		if !ok {
+			return EINVAL
+		}
+
+		if !vm.Memory.WriteUint64Le(resultPtr, t) {
+			return EFAULT
+		}
+		return ESUCCESS
+	}
+	return reflect.ValueOf(body)
+}
+
+// VirtualClock is a clock which only advances when requested with Advance, so that the guest
+// observes the same times across runs. All the clocks start at zero, including the realtime
+// one which is the Unix epoch.
+type VirtualClock struct {
+	elapsed uint64
+}
+
+func NewVirtualClock() *VirtualClock {
+	return &VirtualClock{}
+}
+
+// Advance advances the clock by d.
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.elapsed += uint64(d)
+}
+
+func (c *VirtualClock) Time(id ClockID) (uint64, bool) {
+	if id > ClockThreadCPUTime {
+		return 0, false
+	}
+	return c.elapsed, true
+}
+
+func (c *VirtualClock) Resolution(id ClockID) (uint64, bool) {
+	if id > ClockThreadCPUTime {
+		return 0, false
+	}
+	return 1, true
+}
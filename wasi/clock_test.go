@@ -0,0 +1,63 @@
+package wasi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock map[ClockID]uint64
+
+func (c fakeClock) Time(id ClockID) (uint64, bool) {
+	t, ok := c[id]
+	return t, ok
+}
+
+func (c fakeClock) Resolution(id ClockID) (uint64, bool) {
+	_, ok := c[id]
+	return 10, ok
+}
+
+func TestWASI_clock(t *testing.T) {
+	vm := newTestVM()
+	w := New(WithClock(fakeClock{ClockRealtime: 1234, ClockProcessCPUTime: 42}))
+	timeGet := w.clock_time_get(vm).Interface().(func(uint32, uint64, uint32) uint32)
+	resGet := w.clock_res_get(vm).Interface().(func(uint32, uint32) uint32)
+
+	require.Equal(t, ESUCCESS, timeGet(uint32(ClockRealtime), 0, 8))
+	actual, _ := vm.Memory.ReadUint64Le(8)
+	assert.Equal(t, uint64(1234), actual)
+
+	require.Equal(t, ESUCCESS, timeGet(uint32(ClockProcessCPUTime), 0, 8))
+	actual, _ = vm.Memory.ReadUint64Le(8)
+	assert.Equal(t, uint64(42), actual)
+
+	require.Equal(t, ESUCCESS, resGet(uint32(ClockRealtime), 16))
+	actual, _ = vm.Memory.ReadUint64Le(16)
+	assert.Equal(t, uint64(10), actual)
+
+	assert.Equal(t, EINVAL, timeGet(uint32(ClockMonotonic), 0, 8))
+	assert.Equal(t, EINVAL, resGet(uint32(ClockMonotonic), 8))
+	assert.Equal(t, EFAULT, timeGet(uint32(ClockRealtime), 0, 65536-7))
+	assert.Equal(t, EFAULT, resGet(uint32(ClockRealtime), 65536-7))
+}
+
+func TestSystemClock(t *testing.T) {
+	c := newSystemClock()
+	t1, ok := c.Time(ClockMonotonic)
+	require.True(t, ok)
+	t2, ok := c.Time(ClockMonotonic)
+	require.True(t, ok)
+	assert.True(t, t1 <= t2)
+
+	_, ok = c.Time(ClockRealtime)
+	assert.True(t, ok)
+
+	for _, id := range []ClockID{ClockProcessCPUTime, ClockThreadCPUTime, 4} {
+		_, ok = c.Time(id)
+		assert.False(t, ok)
+		_, ok = c.Resolution(id)
+		assert.False(t, ok)
+	}
+}
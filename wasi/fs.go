@@ -1,11 +1,16 @@
 package wasi
 
 import (
-	"bytes"
+	"errors"
+	"io"
 	"io/fs"
 	"os"
+	pathpkg "path"
 	"runtime"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 )
 
 const (
@@ -14,16 +19,67 @@ const (
 	O_DIR
 	O_EXCL
 	O_TRUNC
+)
 
+const (
 	// WASI fs rights
-	R_FD_READ = 1 << iota
+	R_FD_DATASYNC = 1 << iota
+	R_FD_READ
 	R_FD_SEEK
 	R_FD_FDSTAT_SET_FLAGS
 	R_FD_SYNC
 	R_FD_TELL
 	R_FD_WRITE
+	R_FD_ADVISE
+	R_FD_ALLOCATE
+	R_PATH_CREATE_DIRECTORY
+	R_PATH_CREATE_FILE
+	R_PATH_LINK_SOURCE
+	R_PATH_LINK_TARGET
+	R_PATH_OPEN
+	R_FD_READDIR
+	R_PATH_READLINK
+	R_PATH_RENAME_SOURCE
+	R_PATH_RENAME_TARGET
+	R_PATH_FILESTAT_GET
+	R_PATH_FILESTAT_SET_SIZE
+	R_PATH_FILESTAT_SET_TIMES
+	R_FD_FILESTAT_GET
+	R_FD_FILESTAT_SET_SIZE
+	R_FD_FILESTAT_SET_TIMES
+	R_PATH_SYMLINK
+	R_PATH_REMOVE_DIRECTORY
+	R_PATH_UNLINK_FILE
+	R_POLL_FD_READWRITE
+	R_SOCK_SHUTDOWN
 )
 
+const (
+	// WASI file types
+	FILETYPE_UNKNOWN = iota
+	FILETYPE_BLOCK_DEVICE
+	FILETYPE_CHARACTER_DEVICE
+	FILETYPE_DIRECTORY
+	FILETYPE_REGULAR_FILE
+	FILETYPE_SOCKET_DGRAM
+	FILETYPE_SOCKET_STREAM
+	FILETYPE_SYMBOLIC_LINK
+)
+
+const (
+	// WASI fd flags
+	FDFLAG_APPEND = 1 << iota
+	FDFLAG_DSYNC
+	FDFLAG_NONBLOCK
+	FDFLAG_RSYNC
+	FDFLAG_SYNC
+)
+
+// WASI lookup flag to follow symbolic links
+const LOOKUP_SYMLINK_FOLLOW = 1
+
+// File is an opened file. To support fd_seek and fd_tell, it must also implement
+// io.Seeker, and io.ReaderAt and io.WriterAt for fd_pread and fd_pwrite.
 type File interface {
 	Read([]byte) (int, error)
 	Write([]byte) (int, error)
@@ -37,6 +93,28 @@ type FS interface {
 	OpenWASI(dirFlags uint32, path string, oFlags uint32, fsRights, fsRightsInheriting uint64, fdFlags uint32) (File, error)
 }
 
+// StatFile is a File supporting fd_filestat_get.
+type StatFile interface {
+	File
+	Stat() (fs.FileInfo, error)
+}
+
+// StatFS is an FS supporting path_filestat_get.
+type StatFS interface {
+	FS
+	// StatWASI is similar to os.Stat, or to os.Lstat if lookupFlags lacks LOOKUP_SYMLINK_FOLLOW.
+	// The path "." refers to the directory itself.
+	StatWASI(lookupFlags uint32, path string) (fs.FileInfo, error)
+}
+
+// ReadDirFS is an FS supporting fd_readdir.
+type ReadDirFS interface {
+	FS
+	// ReadDirWASI is similar to os.ReadDir. The entries must be sorted by their names so
+	// that the cookies of fd_readdir, which are indexes into them, are stable.
+	ReadDirWASI(path string) ([]fs.DirEntry, error)
+}
+
 type dirFS string
 
 // DirFS returns a file system (a wasi.FS) for the tree of files rooted at
@@ -46,7 +124,7 @@ func DirFS(dir string) FS {
 	return dirFS(dir)
 }
 
-func posixOpenFlags(oFlags uint32, fsRights uint64) (pFlags int) {
+func posixOpenFlags(oFlags uint32, fsRights uint64, fdFlags uint32) (pFlags int) {
 	if fsRights&R_FD_WRITE != 0 {
 		pFlags |= os.O_RDWR
 	}
@@ -59,6 +137,9 @@ func posixOpenFlags(oFlags uint32, fsRights uint64) (pFlags int) {
 	if oFlags&O_TRUNC != 0 {
 		pFlags |= os.O_TRUNC
 	}
+	if fdFlags&FDFLAG_APPEND != 0 {
+		pFlags |= os.O_APPEND
+	}
 	return
 }
 
@@ -71,41 +152,100 @@ func (dir dirFS) OpenWASI(dirFlags uint32, path string, oFlags uint32, fsRights,
 	if oFlags&O_DIR != 0 {
 		mode |= fs.ModeDir
 	}
-	f, err := os.OpenFile(string(dir)+"/"+path, posixOpenFlags(oFlags, fsRights), mode)
+	f, err := os.OpenFile(string(dir)+"/"+path, posixOpenFlags(oFlags, fsRights, fdFlags), mode)
 	if err != nil {
 		return nil, err
 	}
 	return f, nil
 }
 
+func (dir dirFS) StatWASI(lookupFlags uint32, path string) (fs.FileInfo, error) {
+	if !fs.ValidPath(path) || runtime.GOOS == "windows" && strings.IndexAny(path, `\:`) >= 0 {
+		return nil, &os.PathError{Op: "stat", Path: path, Err: os.ErrInvalid}
+	}
+	if lookupFlags&LOOKUP_SYMLINK_FOLLOW == 0 {
+		return os.Lstat(string(dir) + "/" + path)
+	}
+	return os.Stat(string(dir) + "/" + path)
+}
+
+func (dir dirFS) ReadDirWASI(path string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(path) || runtime.GOOS == "windows" && strings.IndexAny(path, `\:`) >= 0 {
+		return nil, &os.PathError{Op: "readdir", Path: path, Err: os.ErrInvalid}
+	}
+	return os.ReadDir(string(dir) + "/" + path)
+}
+
 type memFS struct {
 	files map[string][]byte
+	// dirs holds the directories other than the root "."
+	dirs map[string]struct{}
 }
 
+// MemFS returns an empty in-memory file system. Besides regular files, opening a path
+// with O_CREATE|O_DIR creates a directory. This is only for the host to populate it:
+// path_open rejects the combination as POSIX does. Files can only be created in existing
+// directories.
 func MemFS() FS {
 	return &memFS{
 		files: map[string][]byte{},
+		dirs:  map[string]struct{}{},
 	}
 }
 
+func (m *memFS) isDir(path string) bool {
+	_, ok := m.dirs[path]
+	return ok || path == "."
+}
+
+// checkParent returns an error unless the parent of path is an existing directory.
+func (m *memFS) checkParent(op, path string) error {
+	parent := pathpkg.Dir(path)
+	if _, ok := m.files[parent]; ok {
+		return &os.PathError{Op: op, Path: path, Err: syscall.ENOTDIR}
+	}
+	if !m.isDir(parent) {
+		return &os.PathError{Op: op, Path: path, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
 func (m *memFS) OpenWASI(dirFlags uint32, path string, oFlags uint32, fsRights, fsRightsInheriting uint64, fdFlags uint32) (File, error) {
 	if !fs.ValidPath(path) {
 		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrInvalid}
 	}
 
-	var buf []byte
-	if oFlags&O_CREATE == 0 {
-		bts, ok := m.files[path]
-		if !ok {
-			return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	bts, isFile := m.files[path]
+	exists := isFile || m.isDir(path)
+	switch {
+	case exists && oFlags&(O_CREATE|O_EXCL) == O_CREATE|O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrExist}
+	case isFile && oFlags&O_DIR != 0:
+		return nil, &os.PathError{Op: "open", Path: path, Err: syscall.ENOTDIR}
+	case !exists && oFlags&O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	case !exists:
+		if err := m.checkParent("open", path); err != nil {
+			return nil, err
 		}
+	}
 
-		if oFlags&O_TRUNC == 0 {
-			buf = append(buf, bts...)
-		}
+	if !m.isDir(path) && oFlags&O_DIR != 0 {
+		m.dirs[path] = struct{}{}
+	}
+	if m.isDir(path) {
+		return &memDir{name: pathpkg.Base(path)}, nil
+	}
+
+	var buf []byte
+	if oFlags&O_TRUNC == 0 {
+		buf = append(buf, bts...)
 	}
 
-	ret := &memFile{buf: bytes.NewBuffer(buf)}
+	ret := &memFile{name: pathpkg.Base(path), buf: buf, append: fdFlags&FDFLAG_APPEND != 0}
+	if ret.append {
+		ret.pos = int64(len(buf))
+	}
 
 	if fsRights&R_FD_WRITE != 0 {
 		ret.flush = func(bts []byte) {
@@ -116,22 +256,188 @@ func (m *memFS) OpenWASI(dirFlags uint32, path string, oFlags uint32, fsRights,
 	return ret, nil
 }
 
+func (m *memFS) StatWASI(lookupFlags uint32, path string) (fs.FileInfo, error) {
+	if !fs.ValidPath(path) {
+		return nil, &os.PathError{Op: "stat", Path: path, Err: os.ErrInvalid}
+	}
+	if m.isDir(path) {
+		return newMemDirInfo(pathpkg.Base(path)), nil
+	}
+
+	bts, ok := m.files[path]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
+	}
+	return newMemFileInfo(pathpkg.Base(path), len(bts)), nil
+}
+
+func (m *memFS) ReadDirWASI(path string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(path) {
+		return nil, &os.PathError{Op: "readdir", Path: path, Err: os.ErrInvalid}
+	}
+	if !m.isDir(path) {
+		if _, ok := m.files[path]; ok {
+			return nil, &os.PathError{Op: "readdir", Path: path, Err: syscall.ENOTDIR}
+		}
+		return nil, &os.PathError{Op: "readdir", Path: path, Err: os.ErrNotExist}
+	}
+
+	var ret []fs.DirEntry
+	for name, bts := range m.files {
+		if name != path && pathpkg.Dir(name) == path {
+			ret = append(ret, newMemFileInfo(pathpkg.Base(name), len(bts)))
+		}
+	}
+	for name := range m.dirs {
+		// the root "." is its own parent
+		if name != path && pathpkg.Dir(name) == path {
+			ret = append(ret, newMemDirInfo(pathpkg.Base(name)))
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name() < ret[j].Name() })
+	return ret, nil
+}
+
+// memFileInfo is the fs.FileInfo and fs.DirEntry of files in memFS.
+// Their modification times are zero.
+type memFileInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+}
+
+func newMemFileInfo(name string, size int) *memFileInfo {
+	return &memFileInfo{name: name, size: int64(size), mode: 0644}
+}
+
+func newMemDirInfo(name string) *memFileInfo {
+	return &memFileInfo{name: name, mode: fs.ModeDir | 0755}
+}
+
+func (fi *memFileInfo) Name() string               { return fi.name }
+func (fi *memFileInfo) Size() int64                { return fi.size }
+func (fi *memFileInfo) Mode() fs.FileMode          { return fi.mode }
+func (fi *memFileInfo) ModTime() time.Time         { return time.Time{} }
+func (fi *memFileInfo) IsDir() bool                { return fi.mode.IsDir() }
+func (fi *memFileInfo) Sys() interface{}           { return nil }
+func (fi *memFileInfo) Type() fs.FileMode          { return fi.mode.Type() }
+func (fi *memFileInfo) Info() (fs.FileInfo, error) { return fi, nil }
+
+// memDir is an opened directory of memFS. It is listed with fd_readdir.
+type memDir struct {
+	name string
+}
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: d.name, Err: syscall.EISDIR}
+}
+
+func (d *memDir) Write([]byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: d.name, Err: syscall.EISDIR}
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) {
+	return newMemDirInfo(d.name), nil
+}
+
+func (d *memDir) Close() error {
+	return nil
+}
+
 type memFile struct {
-	buf   *bytes.Buffer
-	flush func(bts []byte)
+	name string
+	buf  []byte
+	pos  int64
+	// append makes every write go to the end regardless of the position
+	append bool
+	flush  func(bts []byte)
 }
 
+var (
+	_ io.Seeker   = &memFile{}
+	_ io.ReaderAt = &memFile{}
+	_ io.WriterAt = &memFile{}
+	_ StatFile    = &memFile{}
+	_ StatFS      = &memFS{}
+	_ StatFS      = dirFS("")
+	_ StatFile    = &memDir{}
+	_ ReadDirFS   = &memFS{}
+	_ ReadDirFS   = dirFS("")
+	_ fs.DirEntry = &memFileInfo{}
+)
+
 func (f *memFile) Read(p []byte) (int, error) {
-	return f.buf.Read(p)
+	n, err := f.ReadAt(p, f.pos)
+	f.pos += int64(n)
+	if n > 0 && err == io.EOF {
+		// io.Reader reports EOF only when nothing is read
+		err = nil
+	}
+	return n, err
 }
 
 func (f *memFile) Write(p []byte) (int, error) {
-	return f.buf.Write(p)
+	if f.append {
+		f.pos = int64(len(f.buf))
+	}
+	n, err := f.WriteAt(p, f.pos)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	} else if off >= int64(len(f.buf)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.buf[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	if end := off + int64(len(p)); end > int64(len(f.buf)) {
+		// writing past the end fills the gap with zeros
+		f.buf = append(f.buf, make([]byte, end-int64(len(f.buf)))...)
+	}
+	return copy(f.buf[off:], p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = f.pos + offset
+	case io.SeekEnd:
+		pos = int64(len(f.buf)) + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.pos = pos
+	return pos, nil
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	return newMemFileInfo(f.name, len(f.buf)), nil
 }
 
 func (f *memFile) Close() error {
 	if f.flush != nil {
-		f.flush(f.buf.Bytes())
+		f.flush(f.buf)
 	}
 	return nil
 }
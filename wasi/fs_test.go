@@ -0,0 +1,209 @@
+package wasi
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemFile(t *testing.T) {
+	var flushed []byte
+	f := &memFile{buf: []byte("hello"), flush: func(b []byte) { flushed = b }}
+
+	b := make([]byte, 3)
+	n, err := f.Read(b)
+	require.NoError(t, err)
+	assert.Equal(t, "hel", string(b[:n]))
+
+	pos, err := f.Seek(-1, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), pos)
+	n, err = f.Read(b)
+	require.NoError(t, err)
+	assert.Equal(t, "llo", string(b[:n]))
+	_, err = f.Read(b)
+	assert.Equal(t, io.EOF, err)
+
+	// positional accesses don't move the position
+	n, err = f.ReadAt(b, 3)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "lo", string(b[:n]))
+	_, err = f.WriteAt([]byte("J"), 0)
+	require.NoError(t, err)
+	pos, err = f.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), pos)
+
+	// writing past the end fills the gap with zeros
+	_, err = f.Seek(2, io.SeekEnd)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("!"))
+	require.NoError(t, err)
+
+	_, err = f.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+	_, err = f.Seek(0, 3)
+	assert.Error(t, err)
+
+	require.NoError(t, f.Close())
+	assert.Equal(t, "Jello\x00\x00!", string(flushed))
+}
+
+func TestFS_StatWASI(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), []byte("hello"), 0644))
+	require.NoError(t, os.Symlink("file", filepath.Join(dir, "link")))
+
+	mem := MemFS().(*memFS)
+	mem.files["file"] = []byte("hello")
+
+	for _, c := range []struct {
+		name string
+		fsys StatFS
+	}{
+		{name: "dir", fsys: DirFS(dir).(StatFS)},
+		{name: "mem", fsys: mem},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			fi, err := c.fsys.StatWASI(LOOKUP_SYMLINK_FOLLOW, "file")
+			require.NoError(t, err)
+			assert.Equal(t, "file", fi.Name())
+			assert.Equal(t, int64(5), fi.Size())
+			assert.True(t, fi.Mode().IsRegular())
+
+			fi, err = c.fsys.StatWASI(LOOKUP_SYMLINK_FOLLOW, ".")
+			require.NoError(t, err)
+			assert.True(t, fi.IsDir())
+
+			_, err = c.fsys.StatWASI(0, "missing")
+			assert.True(t, errors.Is(err, fs.ErrNotExist))
+			_, err = c.fsys.StatWASI(0, "../file")
+			assert.True(t, errors.Is(err, fs.ErrInvalid))
+		})
+	}
+
+	fi, err := DirFS(dir).(StatFS).StatWASI(0, "link")
+	require.NoError(t, err)
+	assert.Equal(t, fs.ModeSymlink, fi.Mode().Type())
+}
+
+func TestMemFS_OpenWASI_directories(t *testing.T) {
+	m := MemFS()
+	open := func(path string, oFlags uint32) error {
+		f, err := m.OpenWASI(0, path, oFlags, R_FD_WRITE, 0, 0)
+		if err == nil {
+			require.NoError(t, f.Close())
+		}
+		return err
+	}
+
+	require.NoError(t, open("dir", O_CREATE|O_DIR))
+	require.NoError(t, open("dir/file", O_CREATE))
+	require.NoError(t, open("dir", O_DIR))
+
+	for _, c := range []struct {
+		path   string
+		oFlags uint32
+		err    error
+	}{
+		{path: "missing/file", oFlags: O_CREATE, err: fs.ErrNotExist},
+		{path: "dir/file/file", oFlags: O_CREATE, err: syscall.ENOTDIR},
+		{path: "dir/file", oFlags: O_DIR, err: syscall.ENOTDIR},
+		{path: "dir", oFlags: O_CREATE | O_EXCL, err: fs.ErrExist},
+		{path: "dir/missing", err: fs.ErrNotExist},
+	} {
+		err := open(c.path, c.oFlags)
+		assert.True(t, errors.Is(err, c.err), "%s: %v", c.path, err)
+	}
+
+	f, err := m.OpenWASI(0, "dir", 0, 0, 0, 0)
+	require.NoError(t, err)
+	_, err = f.Read(make([]byte, 1))
+	assert.True(t, errors.Is(err, syscall.EISDIR))
+}
+
+func TestFS_ReadDirWASI(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	for _, name := range []string{"b", "a", "sub/c"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	mem := MemFS().(*memFS)
+	mem.dirs["sub"] = struct{}{}
+	for _, name := range []string{"b", "a", "sub/c"} {
+		mem.files[name] = nil
+	}
+
+	for _, c := range []struct {
+		name string
+		fsys ReadDirFS
+	}{
+		{name: "dir", fsys: DirFS(dir).(ReadDirFS)},
+		{name: "mem", fsys: mem},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			entries, err := c.fsys.ReadDirWASI(".")
+			require.NoError(t, err)
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			assert.Equal(t, []string{"a", "b", "sub"}, names)
+			assert.True(t, entries[2].IsDir())
+
+			entries, err = c.fsys.ReadDirWASI("sub")
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, "c", entries[0].Name())
+
+			_, err = c.fsys.ReadDirWASI("a")
+			assert.True(t, errors.Is(err, syscall.ENOTDIR))
+			_, err = c.fsys.ReadDirWASI("missing")
+			assert.True(t, errors.Is(err, fs.ErrNotExist))
+		})
+	}
+}
+
+func TestFS_OpenWASI_append(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		fsys FS
+	}{
+		{name: "dir", fsys: DirFS(t.TempDir())},
+		{name: "mem", fsys: MemFS()},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			f, err := c.fsys.OpenWASI(0, "file", O_CREATE, R_FD_WRITE, 0, 0)
+			require.NoError(t, err)
+			_, err = f.Write([]byte("hello"))
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			f, err = c.fsys.OpenWASI(0, "file", 0, R_FD_READ|R_FD_WRITE, 0, FDFLAG_APPEND)
+			require.NoError(t, err)
+			_, err = f.Write([]byte(" world"))
+			require.NoError(t, err)
+			// writes go to the end even after seeking
+			_, err = f.(io.Seeker).Seek(0, io.SeekStart)
+			require.NoError(t, err)
+			_, err = f.Write([]byte("!"))
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			f, err = c.fsys.OpenWASI(0, "file", 0, R_FD_READ, 0, 0)
+			require.NoError(t, err)
+			b, err := io.ReadAll(f)
+			require.NoError(t, err)
+			assert.Equal(t, "hello world!", string(b))
+			require.NoError(t, f.Close())
+		})
+	}
+}
@@ -1,13 +1,17 @@
 package wasi
 
 import (
+	"crypto/rand"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
-	"math/rand"
+	mrand "math/rand"
 	"os"
 	"reflect"
+	"syscall"
+	"time"
 
 	"github.com/mathetake/gasm/hostfunc"
 	"github.com/mathetake/gasm/wasm"
@@ -22,13 +26,40 @@ type fileEntry struct {
 	path    string
 	fileSys FS
 	file    File
+	// openedFS and openedPath locate the file opened with path_open, for fd_readdir
+	openedFS   FS
+	openedPath string
+	// rights and fdFlags are the ones requested in path_open
+	rights, rightsInheriting uint64
+	fdFlags                  uint32
 }
 
+const (
+	// fileRights are the rights applicable to regular files.
+	fileRights = R_FD_DATASYNC | R_FD_READ | R_FD_SEEK | R_FD_FDSTAT_SET_FLAGS | R_FD_SYNC | R_FD_TELL | R_FD_WRITE |
+		R_FD_ADVISE | R_FD_ALLOCATE | R_FD_FILESTAT_GET | R_FD_FILESTAT_SET_SIZE | R_FD_FILESTAT_SET_TIMES | R_POLL_FD_READWRITE
+
+	// dirRights are the rights applicable to directories.
+	dirRights = R_FD_FDSTAT_SET_FLAGS | R_FD_SYNC | R_FD_ADVISE | R_PATH_CREATE_DIRECTORY | R_PATH_CREATE_FILE |
+		R_PATH_LINK_SOURCE | R_PATH_LINK_TARGET | R_PATH_OPEN | R_FD_READDIR | R_PATH_READLINK | R_PATH_RENAME_SOURCE |
+		R_PATH_RENAME_TARGET | R_PATH_FILESTAT_GET | R_PATH_FILESTAT_SET_SIZE | R_PATH_FILESTAT_SET_TIMES |
+		R_FD_FILESTAT_GET | R_FD_FILESTAT_SET_TIMES | R_PATH_SYMLINK | R_PATH_REMOVE_DIRECTORY | R_PATH_UNLINK_FILE
+)
+
 type WASI struct {
 	stdin io.Reader
 	stdout,
 	stderr io.Writer
-	opened map[uint32]fileEntry
+	opened  map[uint32]fileEntry
+	args    []string
+	environ []string
+	clock   Clock
+	rand    io.Reader
+	// fdRand picks the numbers of opened files. It is independent of rand
+	// so that opening files doesn't consume the bytes of random_get.
+	fdRand *mrand.Rand
+	// sequentialFDs allocates the lowest unused fds instead of random ones
+	sequentialFDs bool
 }
 
 type Option func(*WASI)
@@ -51,6 +82,49 @@ func Stderr(writer io.Writer) Option {
 	}
 }
 
+// Args sets the program arguments returned by args_get. The first one is conventionally the program name.
+func Args(args ...string) Option {
+	return func(w *WASI) {
+		w.args = args
+	}
+}
+
+// Environ sets the environment variables returned by environ_get, each in the form "KEY=value".
+// The environment is empty by default.
+func Environ(environ ...string) Option {
+	return func(w *WASI) {
+		w.environ = environ
+	}
+}
+
+// InheritEnv passes the environment variables of the host process to the guest.
+func InheritEnv() Option {
+	return func(w *WASI) {
+		w.environ = os.Environ()
+	}
+}
+
+// RandomSource sets the source of random_get. It defaults to crypto/rand.Reader.
+func RandomSource(r io.Reader) Option {
+	return func(w *WASI) {
+		w.rand = r
+	}
+}
+
+// Deterministic makes the execution reproducible: the clocks only advance when the host
+// advances them, random_get returns numbers generated from seed, and opened files get the
+// lowest unused fds. The clock is a new VirtualClock unless one is set with WithClock,
+// before or after this option, so that the host can call its Advance.
+func Deterministic(seed int64) Option {
+	return func(w *WASI) {
+		if _, ok := w.clock.(*systemClock); ok {
+			w.clock = NewVirtualClock()
+		}
+		w.rand = mrand.New(mrand.NewSource(seed))
+		w.sequentialFDs = true
+	}
+}
+
 func Preopen(dir string, fileSys FS) Option {
 	return func(w *WASI) {
 		w.opened[uint32(len(w.opened))+3] = fileEntry{
@@ -66,6 +140,9 @@ func New(opts ...Option) *WASI {
 		stdout: os.Stdout,
 		stderr: os.Stderr,
 		opened: map[uint32]fileEntry{},
+		clock:  newSystemClock(),
+		rand:   rand.Reader,
+		fdRand: mrand.New(mrand.NewSource(time.Now().UnixNano())),
 	}
 
 	// apply functional options
@@ -76,21 +153,133 @@ func New(opts ...Option) *WASI {
 	return ret
 }
 
-func (w *WASI) randUnusedFD() uint32 {
-	fd := uint32(rand.Int31())
+func (w *WASI) newFD() uint32 {
+	if w.sequentialFDs {
+		return w.lowestUnusedFD()
+	}
+	return w.randUnusedFD()
+}
+
+func (w *WASI) lowestUnusedFD() uint32 {
+	// 0, 1 and 2 are reserved for stdio
+	fd := uint32(3)
 	for {
 		if _, ok := w.opened[fd]; !ok {
 			return fd
 		}
+		fd++
+	}
+}
+
+func (w *WASI) randUnusedFD() uint32 {
+	fd := w.fdRand.Uint32() % (1 << 31)
+	for {
+		// 0, 1 and 2 are reserved for stdio
+		if _, ok := w.opened[fd]; !ok && fd > 2 {
+			return fd
+		}
 		fd = (fd + 1) % (1 << 31)
 	}
 }
 
+func (w *WASI) random_get(vm *wasm.VirtualMachine) reflect.Value {
+	body := func(bufPtr, bufLen uint32) (err uint32) {
+		buf, ok := vm.Memory.Read(bufPtr, bufLen)
+		if !ok {
+			return EFAULT
+		}
+
+		if _, err := io.ReadFull(w.rand, buf); err != nil {
+			return EIO
+		}
+		return ESUCCESS
+	}
+	return reflect.ValueOf(body)
+}
+
+func (w *WASI) args_sizes_get(vm *wasm.VirtualMachine) reflect.Value {
+	body := func(argcPtr, argvBufSizePtr uint32) (err uint32) {
+		return writeStringArraySizes(vm.Memory, argcPtr, argvBufSizePtr, w.args)
+	}
+	return reflect.ValueOf(body)
+}
+
+func (w *WASI) args_get(vm *wasm.VirtualMachine) reflect.Value {
+	body := func(argvPtr, argvBufPtr uint32) (err uint32) {
+		return writeStringArray(vm.Memory, argvPtr, argvBufPtr, w.args)
+	}
+	return reflect.ValueOf(body)
+}
+
+func (w *WASI) environ_sizes_get(vm *wasm.VirtualMachine) reflect.Value {
+	body := func(environCountPtr, environBufSizePtr uint32) (err uint32) {
+		return writeStringArraySizes(vm.Memory, environCountPtr, environBufSizePtr, w.environ)
+	}
+	return reflect.ValueOf(body)
+}
+
+func (w *WASI) environ_get(vm *wasm.VirtualMachine) reflect.Value {
+	body := func(environPtr, environBufPtr uint32) (err uint32) {
+		return writeStringArray(vm.Memory, environPtr, environBufPtr, w.environ)
+	}
+	return reflect.ValueOf(body)
+}
+
+// writeStringArraySizes writes the number of strs and the size of the buffer
+// holding them null-terminated, as args_sizes_get and environ_sizes_get do.
+func writeStringArraySizes(mem *wasm.Memory, countPtr, bufSizePtr uint32, strs []string) uint32 {
+	var size uint32
+	for _, s := range strs {
+		size += uint32(len(s)) + 1
+	}
+
+	if !mem.WriteUint32Le(countPtr, uint32(len(strs))) || !mem.WriteUint32Le(bufSizePtr, size) {
+		return EFAULT
+	}
+	return ESUCCESS
+}
+
+// writeStringArray writes strs null-terminated into the buffer at bufPtr, and their
+// pointers into the array at ptrsPtr, as args_get and environ_get do.
+func writeStringArray(mem *wasm.Memory, ptrsPtr, bufPtr uint32, strs []string) uint32 {
+	var size uint32
+	for _, s := range strs {
+		size += uint32(len(s)) + 1
+	}
+
+	ptrs, ok := mem.Read(ptrsPtr, uint32(len(strs))*4)
+	if !ok {
+		return EFAULT
+	}
+	buf, ok := mem.Read(bufPtr, size)
+	if !ok {
+		return EFAULT
+	}
+
+	var offset uint32
+	for i, s := range strs {
+		binary.LittleEndian.PutUint32(ptrs[i*4:], bufPtr+offset)
+		offset += uint32(copy(buf[offset:], s))
+		buf[offset] = 0
+		offset++
+	}
+	return ESUCCESS
+}
+
 func (w *WASI) fd_prestat_get(vm *wasm.VirtualMachine) reflect.Value {
 	body := func(fd uint32, bufPtr uint32) (err uint32) {
-		if _, ok := w.opened[fd]; !ok {
+		f, ok := w.opened[fd]
+		if !ok || f.fileSys == nil {
 			return EBADF
 		}
+
+		// prestat is the tag u8 which is 0 for directories, and the length of the name u32 at 4
+		buf, ok := vm.Memory.Read(bufPtr, 8)
+		if !ok {
+			return EFAULT
+		}
+		buf[0], buf[1], buf[2], buf[3] = 0, 0, 0, 0
+		binary.LittleEndian.PutUint32(buf[4:], uint32(len(f.path)))
 		return ESUCCESS
 	}
 	return reflect.ValueOf(body)
@@ -99,15 +288,17 @@ func (w *WASI) fd_prestat_get(vm *wasm.VirtualMachine) reflect.Value {
 func (w *WASI) fd_prestat_dir_name(vm *wasm.VirtualMachine) reflect.Value {
 	body := func(fd uint32, pathPtr uint32, pathLen uint32) (err uint32) {
 		f, ok := w.opened[fd]
-		if !ok {
-			return EINVAL
+		if !ok || f.fileSys == nil {
+			return EBADF
 		}
 
-		if uint32(len(f.path)) < pathLen {
+		if uint32(len(f.path)) > pathLen {
 			return ENAMETOOLONG
 		}
 
-		copy(vm.Memory[pathPtr:], f.path)
+		if !vm.Memory.Write(pathPtr, []byte(f.path)) {
+			return EFAULT
+		}
 		return ESUCCESS
 	}
 	return reflect.ValueOf(body)
@@ -115,15 +306,262 @@ func (w *WASI) fd_prestat_dir_name(vm *wasm.VirtualMachine) reflect.Value {
 
 func (w *WASI) fd_fdstat_get(vm *wasm.VirtualMachine) reflect.Value {
 	body := func(fd uint32, bufPtr uint32) (err uint32) {
-		if _, ok := w.opened[fd]; !ok {
+		var filetype uint8
+		var flags uint16
+		var rights, rightsInheriting uint64
+		switch f, ok := w.opened[fd]; {
+		case fd == 0:
+			filetype, rights = FILETYPE_CHARACTER_DEVICE, R_FD_READ|R_POLL_FD_READWRITE
+		case fd <= 2:
+			filetype, rights = FILETYPE_CHARACTER_DEVICE, R_FD_WRITE|R_POLL_FD_READWRITE
+		case !ok:
 			return EBADF
+		case f.file == nil:
+			// preopened directory
+			filetype, rights, rightsInheriting = FILETYPE_DIRECTORY, dirRights, dirRights|fileRights
+		default:
+			filetype = FILETYPE_UNKNOWN
+			if sf, ok := f.file.(StatFile); ok {
+				if fi, err := sf.Stat(); err == nil {
+					filetype = fileTypeOf(fi.Mode())
+				}
+			}
+			flags, rights, rightsInheriting = uint16(f.fdFlags), f.rights, f.rightsInheriting
 		}
-		binary.LittleEndian.PutUint64(vm.Memory[bufPtr+16:], R_FD_READ|R_FD_WRITE)
+
+		// fdstat is 24 bytes: filetype u8, flags u16 at 2, rights_base u64 at 8, rights_inheriting u64 at 16
+		buf, ok := vm.Memory.Read(bufPtr, 24)
+		if !ok {
+			return EFAULT
+		}
+		buf[0], buf[1] = filetype, 0
+		binary.LittleEndian.PutUint16(buf[2:], flags)
+		binary.LittleEndian.PutUint32(buf[4:], 0)
+		binary.LittleEndian.PutUint64(buf[8:], rights)
+		binary.LittleEndian.PutUint64(buf[16:], rightsInheriting)
 		return ESUCCESS
 	}
 	return reflect.ValueOf(body)
 }
 
+func (w *WASI) fd_filestat_get(vm *wasm.VirtualMachine) reflect.Value {
+	return w.fdFilestatGet(vm, writeFilestat)
+}
+
+// fd_filestat_get_unstable is fd_filestat_get of wasi_unstable, whose filestat layout differs.
+func (w *WASI) fd_filestat_get_unstable(vm *wasm.VirtualMachine) reflect.Value {
+	return w.fdFilestatGet(vm, writeFilestatUnstable)
+}
+
+func (w *WASI) fdFilestatGet(vm *wasm.VirtualMachine, writeFilestat filestatWriter) reflect.Value {
+	body := func(fd uint32, bufPtr uint32) (err uint32) {
+		var fi fs.FileInfo
+		switch f, ok := w.opened[fd]; {
+		case fd <= 2:
+			return writeFilestat(vm.Memory, bufPtr, FILETYPE_CHARACTER_DEVICE, nil)
+		case !ok:
+			return EBADF
+		case f.file == nil:
+			// preopened directory
+			sfs, ok := f.fileSys.(StatFS)
+			if !ok {
+				return writeFilestat(vm.Memory, bufPtr, FILETYPE_DIRECTORY, nil)
+			}
+			var err error
+			if fi, err = sfs.StatWASI(LOOKUP_SYMLINK_FOLLOW, "."); err != nil {
+				return EIO
+			}
+		default:
+			sf, ok := f.file.(StatFile)
+			if !ok {
+				return ENOTSUP
+			}
+			var err error
+			if fi, err = sf.Stat(); err != nil {
+				return EIO
+			}
+		}
+		return writeFilestat(vm.Memory, bufPtr, fileTypeOf(fi.Mode()), fi)
+	}
+	return reflect.ValueOf(body)
+}
+
+func (w *WASI) path_filestat_get(vm *wasm.VirtualMachine) reflect.Value {
+	return w.pathFilestatGet(vm, writeFilestat)
+}
+
+// path_filestat_get_unstable is path_filestat_get of wasi_unstable, whose filestat layout differs.
+func (w *WASI) path_filestat_get_unstable(vm *wasm.VirtualMachine) reflect.Value {
+	return w.pathFilestatGet(vm, writeFilestatUnstable)
+}
+
+func (w *WASI) pathFilestatGet(vm *wasm.VirtualMachine, writeFilestat filestatWriter) reflect.Value {
+	body := func(fd, lookupFlags, pathPtr, pathLen, bufPtr uint32) (errno uint32) {
+		dir, ok := w.opened[fd]
+		if !ok || dir.fileSys == nil {
+			return EBADF
+		}
+		sfs, ok := dir.fileSys.(StatFS)
+		if !ok {
+			return ENOTSUP
+		}
+
+		path, ok := vm.Memory.ReadString(pathPtr, pathLen)
+		if !ok {
+			return EFAULT
+		}
+
+		fi, err := sfs.StatWASI(lookupFlags, path)
+		if err != nil {
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				return ENOENT
+			case errors.Is(err, fs.ErrPermission):
+				return EACCES
+			case errors.Is(err, fs.ErrInvalid):
+				return EINVAL
+			default:
+				return EIO
+			}
+		}
+		return writeFilestat(vm.Memory, bufPtr, fileTypeOf(fi.Mode()), fi)
+	}
+	return reflect.ValueOf(body)
+}
+
+func (w *WASI) fd_readdir(vm *wasm.VirtualMachine) reflect.Value {
+	body := func(fd, bufPtr, bufLen uint32, cookie uint64, bufUsedPtr uint32) (errno uint32) {
+		f, ok := w.opened[fd]
+		if !ok {
+			if fd <= 2 {
+				return ENOTDIR
+			}
+			return EBADF
+		}
+
+		fileSys, path := f.fileSys, "."
+		if f.file != nil {
+			fileSys, path = f.openedFS, f.openedPath
+		}
+		rfs, ok := fileSys.(ReadDirFS)
+		if !ok {
+			return ENOTSUP
+		}
+
+		entries, err := rfs.ReadDirWASI(path)
+		if err != nil {
+			switch {
+			case errors.Is(err, syscall.ENOTDIR):
+				return ENOTDIR
+			case errors.Is(err, fs.ErrNotExist):
+				return ENOENT
+			default:
+				return EIO
+			}
+		}
+
+		buf, ok := vm.Memory.Read(bufPtr, bufLen)
+		if !ok {
+			return EFAULT
+		}
+
+		// Each dirent is d_next u64, d_ino u64, d_namlen u32 and d_type u8 followed by the name
+		// at 24. The cookie of an entry is its index, and the last one is truncated if it doesn't
+		// fit, which tells the guest to read again from its cookie with a larger buffer.
+		var bufUsed uint32
+		for i := cookie; i < uint64(len(entries)) && bufUsed < bufLen; i++ {
+			name := entries[i].Name()
+			dirent := make([]byte, 24+len(name))
+			binary.LittleEndian.PutUint64(dirent, i+1)
+			binary.LittleEndian.PutUint32(dirent[16:], uint32(len(name)))
+			dirent[20] = fileTypeOf(entries[i].Type())
+			copy(dirent[24:], name)
+			bufUsed += uint32(copy(buf[bufUsed:], dirent))
+		}
+
+		if !vm.Memory.WriteUint32Le(bufUsedPtr, bufUsed) {
+			return EFAULT
+		}
+		return ESUCCESS
+	}
+	return reflect.ValueOf(body)
+}
+
+// filestatWriter writes the filestat of fi at bufPtr. fi may be nil for files without
+// metadata, in which case only the filetype is set.
+type filestatWriter func(mem *wasm.Memory, bufPtr uint32, filetype uint8, fi fs.FileInfo) uint32
+
+// writeFilestat writes the 64-byte filestat of wasi_snapshot_preview1: dev u64, ino u64,
+// filetype u8 at 16, nlink u64 at 24, size u64 at 32, and atim, mtim and ctim u64 at 40.
+// The device, inode and link count aren't available portably, so they are 0, 0 and 1.
+// All the timestamps are the modification time.
+func writeFilestat(mem *wasm.Memory, bufPtr uint32, filetype uint8, fi fs.FileInfo) uint32 {
+	buf, ok := mem.Read(bufPtr, 64)
+	if !ok {
+		return EFAULT
+	}
+	for i := range buf {
+		buf[i] = 0
+	}
+
+	buf[16] = filetype
+	binary.LittleEndian.PutUint64(buf[24:], 1) // nlink
+	putFilestatSizeAndTimes(buf[32:], fi)
+	return ESUCCESS
+}
+
+// writeFilestatUnstable writes the 56-byte filestat of wasi_unstable, which differs from
+// writeFilestat in its u32 nlink at 20, followed by size at 24 and the timestamps at 32.
+func writeFilestatUnstable(mem *wasm.Memory, bufPtr uint32, filetype uint8, fi fs.FileInfo) uint32 {
+	buf, ok := mem.Read(bufPtr, 56)
+	if !ok {
+		return EFAULT
+	}
+	for i := range buf {
+		buf[i] = 0
+	}
+
+	buf[16] = filetype
+	binary.LittleEndian.PutUint32(buf[20:], 1) // nlink
+	putFilestatSizeAndTimes(buf[24:], fi)
+	return ESUCCESS
+}
+
+// putFilestatSizeAndTimes writes the size, atim, mtim and ctim of fi into buf.
+func putFilestatSizeAndTimes(buf []byte, fi fs.FileInfo) {
+	if fi == nil {
+		return
+	}
+	binary.LittleEndian.PutUint64(buf, uint64(fi.Size()))
+	var mtim uint64
+	if t := fi.ModTime(); !t.IsZero() {
+		mtim = uint64(t.UnixNano())
+	}
+	binary.LittleEndian.PutUint64(buf[8:], mtim)  // atim
+	binary.LittleEndian.PutUint64(buf[16:], mtim) // mtim
+	binary.LittleEndian.PutUint64(buf[24:], mtim) // ctim
+}
+
+// fileTypeOf returns the WASI filetype of mode.
+func fileTypeOf(mode fs.FileMode) uint8 {
+	switch {
+	case mode.IsRegular():
+		return FILETYPE_REGULAR_FILE
+	case mode.IsDir():
+		return FILETYPE_DIRECTORY
+	case mode&fs.ModeSymlink != 0:
+		return FILETYPE_SYMBOLIC_LINK
+	case mode&fs.ModeCharDevice != 0:
+		return FILETYPE_CHARACTER_DEVICE
+	case mode&fs.ModeDevice != 0:
+		return FILETYPE_BLOCK_DEVICE
+	case mode&fs.ModeSocket != 0:
+		return FILETYPE_SOCKET_STREAM
+	default:
+		return FILETYPE_UNKNOWN
+	}
+}
+
 func (w *WASI) path_open(vm *wasm.VirtualMachine) reflect.Value {
 	body := func(
 		fd, dirFlags, pathPtr, pathLen, oFlags uint32,
@@ -135,24 +573,44 @@ func (w *WASI) path_open(vm *wasm.VirtualMachine) reflect.Value {
 			return EINVAL
 		}
 
-		path := string(vm.Memory[pathPtr : pathPtr+pathLen])
+		path, ok := vm.Memory.ReadString(pathPtr, pathLen)
+		if !ok {
+			return EFAULT
+		}
+
+		if oFlags&(O_CREATE|O_DIR) == O_CREATE|O_DIR {
+			// directories are not created with path_open
+			return EINVAL
+		}
+
 		f, err := dir.fileSys.OpenWASI(dirFlags, path, oFlags, fsRightsBase, fsRightsInheriting, fdFlags)
 		if err != nil {
 			switch {
 			case errors.Is(err, fs.ErrNotExist):
 				return ENOENT
+			case errors.Is(err, fs.ErrExist):
+				return EEXIST
+			case errors.Is(err, syscall.ENOTDIR):
+				return ENOTDIR
 			default:
 				return EINVAL
 			}
 		}
 
-		newFD := w.randUnusedFD()
+		newFD := w.newFD()
 
 		w.opened[newFD] = fileEntry{
-			file: f,
+			file:             f,
+			openedFS:         dir.fileSys,
+			openedPath:       path,
+			rights:           fsRightsBase,
+			rightsInheriting: fsRightsInheriting,
+			fdFlags:          fdFlags,
 		}
 
-		binary.LittleEndian.PutUint32(vm.Memory[fdPtr:], newFD)
+		if !vm.Memory.WriteUint32Le(fdPtr, newFD) {
+			return EFAULT
+		}
 		return ESUCCESS
 	}
 	return reflect.ValueOf(body)
@@ -178,15 +636,19 @@ func (w *WASI) fd_write(vm *wasm.VirtualMachine) reflect.Value {
 		var nwritten uint32
 		for i := uint32(0); i < iovsLen; i++ {
 			iovPtr := iovsPtr + i*8
-			offset := binary.LittleEndian.Uint32(vm.Memory[iovPtr:])
-			l := binary.LittleEndian.Uint32(vm.Memory[iovPtr+4:])
-			n, err := writer.Write(vm.Memory[offset : offset+l])
+			b, ok := readIOVec(vm.Memory, iovPtr)
+			if !ok {
+				return EFAULT
+			}
+			n, err := writer.Write(b)
 			if err != nil {
-				panic(err)
+				return EIO
 			}
 			nwritten += uint32(n)
 		}
-		binary.LittleEndian.PutUint32(vm.Memory[nwrittenPtr:], nwritten)
+		if !vm.Memory.WriteUint32Le(nwrittenPtr, nwritten) {
+			return EFAULT
+		}
 		return ESUCCESS
 	}
 	return reflect.ValueOf(body)
@@ -210,9 +672,103 @@ func (w *WASI) fd_read(vm *wasm.VirtualMachine) reflect.Value {
 		var nread uint32
 		for i := uint32(0); i < iovsLen; i++ {
 			iovPtr := iovsPtr + i*8
-			offset := binary.LittleEndian.Uint32(vm.Memory[iovPtr:])
-			l := binary.LittleEndian.Uint32(vm.Memory[iovPtr+4:])
-			n, err := reader.Read(vm.Memory[offset : offset+l])
+			b, ok := readIOVec(vm.Memory, iovPtr)
+			if !ok {
+				return EFAULT
+			}
+			n, err := reader.Read(b)
+			nread += uint32(n)
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return EIO
+			}
+		}
+		if !vm.Memory.WriteUint32Le(nreadPtr, nread) {
+			return EFAULT
+		}
+		return ESUCCESS
+	}
+	return reflect.ValueOf(body)
+}
+
+var (
+	// whences map the whence of fd_seek to the one of io.Seeker
+	whences         = []int{io.SeekStart, io.SeekCurrent, io.SeekEnd}
+	whencesUnstable = []int{io.SeekCurrent, io.SeekEnd, io.SeekStart}
+)
+
+func (w *WASI) fd_seek(vm *wasm.VirtualMachine) reflect.Value {
+	return w.seek(vm, whences)
+}
+
+// fd_seek_unstable is fd_seek of wasi_unstable, which numbers whence differently.
+func (w *WASI) fd_seek_unstable(vm *wasm.VirtualMachine) reflect.Value {
+	return w.seek(vm, whencesUnstable)
+}
+
+func (w *WASI) seek(vm *wasm.VirtualMachine, whences []int) reflect.Value {
+	body := func(fd uint32, offset int64, whence uint32, newOffsetPtr uint32) (err uint32) {
+		seeker, errno := w.seeker(fd)
+		if errno != ESUCCESS {
+			return errno
+		}
+
+		if whence >= uint32(len(whences)) {
+			return EINVAL
+		}
+
+		newOffset, err2 := seeker.Seek(offset, whences[whence])
+		if err2 != nil {
+			return EINVAL
+		}
+
+		if !vm.Memory.WriteUint64Le(newOffsetPtr, uint64(newOffset)) {
+			return EFAULT
+		}
+		return ESUCCESS
+	}
+	return reflect.ValueOf(body)
+}
+
+func (w *WASI) fd_tell(vm *wasm.VirtualMachine) reflect.Value {
+	body := func(fd uint32, offsetPtr uint32) (err uint32) {
+		seeker, errno := w.seeker(fd)
+		if errno != ESUCCESS {
+			return errno
+		}
+
+		offset, err2 := seeker.Seek(0, io.SeekCurrent)
+		if err2 != nil {
+			return EIO
+		}
+
+		if !vm.Memory.WriteUint64Le(offsetPtr, uint64(offset)) {
+			return EFAULT
+		}
+		return ESUCCESS
+	}
+	return reflect.ValueOf(body)
+}
+
+func (w *WASI) fd_pread(vm *wasm.VirtualMachine) reflect.Value {
+	body := func(fd uint32, iovsPtr uint32, iovsLen uint32, offset uint64, nreadPtr uint32) (err uint32) {
+		f, errno := w.file(fd)
+		if errno != ESUCCESS {
+			return errno
+		}
+		readerAt, ok := f.(io.ReaderAt)
+		if !ok {
+			return ESPIPE
+		}
+
+		var nread uint32
+		for i := uint32(0); i < iovsLen; i++ {
+			b, ok := readIOVec(vm.Memory, iovsPtr+i*8)
+			if !ok {
+				return EFAULT
+			}
+			n, err := readerAt.ReadAt(b, int64(offset)+int64(nread))
 			nread += uint32(n)
 			if errors.Is(err, io.EOF) {
 				break
@@ -220,12 +776,82 @@ func (w *WASI) fd_read(vm *wasm.VirtualMachine) reflect.Value {
 				return EIO
 			}
 		}
-		binary.LittleEndian.PutUint32(vm.Memory[nreadPtr:], nread)
+		if !vm.Memory.WriteUint32Le(nreadPtr, nread) {
+			return EFAULT
+		}
+		return ESUCCESS
+	}
+	return reflect.ValueOf(body)
+}
+
+func (w *WASI) fd_pwrite(vm *wasm.VirtualMachine) reflect.Value {
+	body := func(fd uint32, iovsPtr uint32, iovsLen uint32, offset uint64, nwrittenPtr uint32) (err uint32) {
+		f, errno := w.file(fd)
+		if errno != ESUCCESS {
+			return errno
+		}
+		writerAt, ok := f.(io.WriterAt)
+		if !ok {
+			return ESPIPE
+		}
+
+		var nwritten uint32
+		for i := uint32(0); i < iovsLen; i++ {
+			b, ok := readIOVec(vm.Memory, iovsPtr+i*8)
+			if !ok {
+				return EFAULT
+			}
+			n, err := writerAt.WriteAt(b, int64(offset)+int64(nwritten))
+			nwritten += uint32(n)
+			if err != nil {
+				return EIO
+			}
+		}
+		if !vm.Memory.WriteUint32Le(nwrittenPtr, nwritten) {
+			return EFAULT
+		}
 		return ESUCCESS
 	}
 	return reflect.ValueOf(body)
 }
 
+// file returns the file opened as fd, which excludes stdio and preopened directories.
+func (w *WASI) file(fd uint32) (File, uint32) {
+	f, ok := w.opened[fd]
+	if !ok || f.file == nil {
+		return nil, EBADF
+	}
+	return f.file, ESUCCESS
+}
+
+// seeker returns the file opened as fd if it is seekable.
+func (w *WASI) seeker(fd uint32) (io.Seeker, uint32) {
+	if fd <= 2 {
+		// stdio
+		return nil, ESPIPE
+	}
+
+	f, errno := w.file(fd)
+	if errno != ESUCCESS {
+		return nil, errno
+	}
+
+	seeker, ok := f.(io.Seeker)
+	if !ok {
+		return nil, ESPIPE
+	}
+	return seeker, ESUCCESS
+}
+
+// readIOVec returns the buffer described by the iovec at iovPtr.
+func readIOVec(mem *wasm.Memory, iovPtr uint32) ([]byte, bool) {
+	iov, ok := mem.Read(iovPtr, 8)
+	if !ok {
+		return nil, false
+	}
+	return mem.Read(binary.LittleEndian.Uint32(iov), binary.LittleEndian.Uint32(iov[4:]))
+}
+
 func (w *WASI) fd_close(vm *wasm.VirtualMachine) reflect.Value {
 	body := func(fd uint32) (err uint32) {
 		f, ok := w.opened[fd]
@@ -251,38 +877,50 @@ func (w *WASI) Modules() map[string]*wasm.Module {
 		wasiSnapshotPreview1Name,
 	} {
 		b.MustSetFunction(wasiName, "proc_exit", proc_exit)
+		b.MustSetFunction(wasiName, "args_sizes_get", w.args_sizes_get)
+		b.MustSetFunction(wasiName, "args_get", w.args_get)
 		b.MustSetFunction(wasiName, "fd_write", w.fd_write)
-		b.MustSetFunction(wasiName, "environ_sizes_get", environ_sizes_get)
-		b.MustSetFunction(wasiName, "environ_get", environ_get)
+		b.MustSetFunction(wasiName, "environ_sizes_get", w.environ_sizes_get)
+		b.MustSetFunction(wasiName, "environ_get", w.environ_get)
+		b.MustSetFunction(wasiName, "clock_res_get", w.clock_res_get)
+		b.MustSetFunction(wasiName, "clock_time_get", w.clock_time_get)
+		b.MustSetFunction(wasiName, "random_get", w.random_get)
 		b.MustSetFunction(wasiName, "fd_prestat_get", w.fd_prestat_get)
 		b.MustSetFunction(wasiName, "fd_prestat_dir_name", w.fd_prestat_dir_name)
 		b.MustSetFunction(wasiName, "fd_fdstat_get", w.fd_fdstat_get)
+		b.MustSetFunction(wasiName, "fd_readdir", w.fd_readdir)
 		b.MustSetFunction(wasiName, "fd_close", w.fd_close)
 		b.MustSetFunction(wasiName, "fd_read", w.fd_read)
+		b.MustSetFunction(wasiName, "fd_tell", w.fd_tell)
+		b.MustSetFunction(wasiName, "fd_pread", w.fd_pread)
+		b.MustSetFunction(wasiName, "fd_pwrite", w.fd_pwrite)
 		b.MustSetFunction(wasiName, "path_open", w.path_open)
 	}
+
+	// the ABIs differ in the following functions
+	b.MustSetFunction(wasiUnstableName, "fd_seek", w.fd_seek_unstable)
+	b.MustSetFunction(wasiSnapshotPreview1Name, "fd_seek", w.fd_seek)
+	b.MustSetFunction(wasiUnstableName, "fd_filestat_get", w.fd_filestat_get_unstable)
+	b.MustSetFunction(wasiSnapshotPreview1Name, "fd_filestat_get", w.fd_filestat_get)
+	b.MustSetFunction(wasiUnstableName, "path_filestat_get", w.path_filestat_get_unstable)
+	b.MustSetFunction(wasiSnapshotPreview1Name, "path_filestat_get", w.path_filestat_get)
 	return b.Done()
 }
 
-func proc_exit(vm *wasm.VirtualMachine) reflect.Value {
-	body := func(uint32) {
-		// not implemented yet
-	}
-	return reflect.ValueOf(body)
+// ExitError is returned as the cause of the error from the virtual machine's call
+// when the guest calls proc_exit. Use errors.As to retrieve it.
+type ExitError struct {
+	Code uint32
 }
 
-func environ_sizes_get(vm *wasm.VirtualMachine) reflect.Value {
-	body := func(uint32, uint32) (err uint32) {
-		// not implemented yet
-		return 0
-	}
-	return reflect.ValueOf(body)
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
 }
 
-func environ_get(vm *wasm.VirtualMachine) reflect.Value {
-	body := func(uint32, uint32) (err uint32) {
-		// not implemented yet
-		return 0
+func proc_exit(vm *wasm.VirtualMachine) reflect.Value {
+	body := func(code uint32) error {
+		// unwinds the guest's call stack
+		return &ExitError{Code: code}
 	}
 	return reflect.ValueOf(body)
 }
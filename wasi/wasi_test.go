@@ -0,0 +1,494 @@
+package wasi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	mrand "math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mathetake/gasm/wasm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestVM() *wasm.VirtualMachine {
+	return &wasm.VirtualMachine{Memory: wasm.NewMemory(1, nil)}
+}
+
+func TestWASI_args(t *testing.T) {
+	w := New(Args("prog", "-v", ""))
+	vm := newTestVM()
+
+	sizesGet := w.args_sizes_get(vm).Interface().(func(uint32, uint32) uint32)
+	require.Equal(t, ESUCCESS, sizesGet(0, 4))
+	argc, _ := vm.Memory.ReadUint32Le(0)
+	bufSize, _ := vm.Memory.ReadUint32Le(4)
+	assert.Equal(t, uint32(3), argc)
+	assert.Equal(t, uint32(9), bufSize)
+
+	argsGet := w.args_get(vm).Interface().(func(uint32, uint32) uint32)
+	require.Equal(t, ESUCCESS, argsGet(16, 32))
+	buf, _ := vm.Memory.Read(32, bufSize)
+	assert.Equal(t, []byte("prog\x00-v\x00\x00"), buf)
+	for i, exp := range []uint32{32, 37, 40} {
+		ptr, _ := vm.Memory.ReadUint32Le(16 + uint32(i)*4)
+		assert.Equal(t, exp, ptr)
+	}
+
+	last := uint32(vm.Memory.Size()) * 65536
+	assert.Equal(t, EFAULT, sizesGet(last-2, 0))
+	assert.Equal(t, EFAULT, argsGet(last-8, 0))
+	assert.Equal(t, EFAULT, argsGet(0, last-8))
+
+	// no arguments by default
+	w = New()
+	require.Equal(t, ESUCCESS, w.args_sizes_get(vm).Interface().(func(uint32, uint32) uint32)(0, 4))
+	argc, _ = vm.Memory.ReadUint32Le(0)
+	bufSize, _ = vm.Memory.ReadUint32Le(4)
+	assert.Equal(t, uint32(0), argc)
+	assert.Equal(t, uint32(0), bufSize)
+}
+
+func TestWASI_environ(t *testing.T) {
+	vm := newTestVM()
+	for _, c := range []struct {
+		w          *WASI
+		exp        []string
+		expBufSize uint32
+	}{
+		{w: New(), exp: nil},
+		{w: New(Environ("A=1", "EMPTY=")), exp: []string{"A=1", "EMPTY="}, expBufSize: 11},
+	} {
+		sizesGet := c.w.environ_sizes_get(vm).Interface().(func(uint32, uint32) uint32)
+		require.Equal(t, ESUCCESS, sizesGet(0, 4))
+		count, _ := vm.Memory.ReadUint32Le(0)
+		bufSize, _ := vm.Memory.ReadUint32Le(4)
+		require.Equal(t, uint32(len(c.exp)), count)
+		require.Equal(t, c.expBufSize, bufSize)
+
+		environGet := c.w.environ_get(vm).Interface().(func(uint32, uint32) uint32)
+		require.Equal(t, ESUCCESS, environGet(16, 64))
+		for i, exp := range c.exp {
+			ptr, _ := vm.Memory.ReadUint32Le(16 + uint32(i)*4)
+			actual, ok := vm.Memory.ReadCString(ptr)
+			require.True(t, ok)
+			assert.Equal(t, exp, actual)
+		}
+	}
+
+	require.NoError(t, os.Setenv("GASM_WASI_TEST", "inherited"))
+	defer os.Unsetenv("GASM_WASI_TEST")
+	assert.Contains(t, New(InheritEnv()).environ, "GASM_WASI_TEST=inherited")
+	assert.NotContains(t, New().environ, "GASM_WASI_TEST=inherited")
+}
+
+func TestWASI_proc_exit(t *testing.T) {
+	typeIndex := uint32(0)
+	m := &wasm.Module{
+		SecTypes: []*wasm.FunctionType{{InputTypes: []wasm.ValueType{wasm.ValueTypeI32}}, {}},
+		SecImports: []*wasm.ImportSegment{{
+			Module: wasiSnapshotPreview1Name, Name: "proc_exit",
+			Desc: &wasm.ImportDesc{Kind: wasm.ExportKindFunction, TypeIndexPtr: &typeIndex},
+		}},
+		SecFunctions: []uint32{1},
+		SecCodes: []*wasm.CodeSegment{{Body: []byte{
+			byte(wasm.OptCodeI32Const), 0x03, byte(wasm.OptCodeCall), 0x00, byte(wasm.OptCodeUnreachable),
+		}}},
+		SecExports: map[string]*wasm.ExportSegment{
+			"_start": {Name: "_start", Desc: &wasm.ExportDesc{Kind: wasm.ExportKindFunction, Index: 1}},
+		},
+	}
+	vm, err := wasm.NewVM(m, New().Modules())
+	require.NoError(t, err)
+
+	_, _, err = vm.ExecExportedFunction("_start")
+	var exitErr *ExitError
+	require.True(t, errors.As(err, &exitErr))
+	assert.Equal(t, uint32(3), exitErr.Code)
+}
+
+func TestWASI_random_get(t *testing.T) {
+	vm := newTestVM()
+	w := New(RandomSource(bytes.NewReader([]byte{1, 2, 3, 4, 5})))
+	randomGet := w.random_get(vm).Interface().(func(uint32, uint32) uint32)
+
+	require.Equal(t, ESUCCESS, randomGet(8, 3))
+	actual, _ := vm.Memory.Read(8, 4)
+	assert.Equal(t, []byte{1, 2, 3, 0}, actual)
+
+	assert.Equal(t, EFAULT, randomGet(65536-1, 2))
+	// the source is exhausted
+	assert.Equal(t, EIO, randomGet(8, 3))
+}
+
+func TestWASI_randUnusedFD(t *testing.T) {
+	w := New()
+	w.fdRand = mrand.New(mrand.NewSource(1))
+	fd := mrand.New(mrand.NewSource(1)).Uint32() % (1 << 31)
+	// the random fd is already opened
+	w.opened[fd] = fileEntry{}
+	assert.Equal(t, fd+1, w.randUnusedFD())
+
+	t.Run("independent of RandomSource", func(t *testing.T) {
+		vm := newTestVM()
+		w := New(RandomSource(bytes.NewReader([]byte{1, 2, 3, 4})), Preopen("/", MemFS()))
+		pathOpen := w.path_open(vm).Interface().(func(uint32, uint32, uint32, uint32, uint32, uint64, uint64, uint32, uint32) uint32)
+		randomGet := w.random_get(vm).Interface().(func(uint32, uint32) uint32)
+		require.True(t, vm.Memory.Write(0, []byte("a")))
+
+		for i := 0; i < 3; i++ {
+			require.Equal(t, ESUCCESS, pathOpen(3, 0, 0, 1, O_CREATE, R_FD_WRITE, 0, 0, 8))
+			fd, _ := vm.Memory.ReadUint32Le(8)
+			assert.True(t, fd > 3)
+		}
+
+		// opening files didn't consume the random bytes
+		require.Equal(t, ESUCCESS, randomGet(16, 4))
+		b, _ := vm.Memory.Read(16, 4)
+		assert.Equal(t, []byte{1, 2, 3, 4}, b)
+	})
+}
+
+func TestDeterministic(t *testing.T) {
+	random := func(w *WASI) []byte {
+		vm := newTestVM()
+		require.Equal(t, ESUCCESS, w.random_get(vm).Interface().(func(uint32, uint32) uint32)(0, 16))
+		b, _ := vm.Memory.Read(0, 16)
+		return b
+	}
+	assert.Equal(t, random(New(Deterministic(1))), random(New(Deterministic(1))))
+	assert.NotEqual(t, random(New(Deterministic(1))), random(New(Deterministic(2))))
+
+	t.Run("clock", func(t *testing.T) {
+		vm := newTestVM()
+		clock := NewVirtualClock()
+		w := New(Deterministic(1), WithClock(clock))
+		timeGet := w.clock_time_get(vm).Interface().(func(uint32, uint64, uint32) uint32)
+
+		// the clock set with WithClock is kept regardless of the order of the options
+		assert.Same(t, clock, New(WithClock(clock), Deterministic(1)).clock)
+		_, ok := New(Deterministic(1)).clock.(*VirtualClock)
+		assert.True(t, ok)
+
+		for _, id := range []ClockID{ClockRealtime, ClockMonotonic, ClockProcessCPUTime, ClockThreadCPUTime} {
+			require.Equal(t, ESUCCESS, timeGet(uint32(id), 0, 0))
+			actual, _ := vm.Memory.ReadUint64Le(0)
+			assert.Equal(t, uint64(0), actual)
+		}
+
+		clock.Advance(time.Second)
+		require.Equal(t, ESUCCESS, timeGet(uint32(ClockMonotonic), 0, 0))
+		actual, _ := vm.Memory.ReadUint64Le(0)
+		assert.Equal(t, uint64(time.Second), actual)
+		assert.Equal(t, EINVAL, timeGet(4, 0, 0))
+	})
+
+	t.Run("fd", func(t *testing.T) {
+		vm := newTestVM()
+		w := New(Deterministic(1), Preopen("/", MemFS()))
+		pathOpen := w.path_open(vm).Interface().(func(uint32, uint32, uint32, uint32, uint32, uint64, uint64, uint32, uint32) uint32)
+		fdClose := w.fd_close(vm).Interface().(func(uint32) uint32)
+		require.True(t, vm.Memory.Write(0, []byte("a")))
+
+		open := func() uint32 {
+			require.Equal(t, ESUCCESS, pathOpen(3, 0, 0, 1, O_CREATE, R_FD_WRITE, 0, 0, 8))
+			fd, _ := vm.Memory.ReadUint32Le(8)
+			return fd
+		}
+		assert.Equal(t, uint32(4), open())
+		assert.Equal(t, uint32(5), open())
+		require.Equal(t, ESUCCESS, fdClose(4))
+		assert.Equal(t, uint32(4), open())
+	})
+}
+
+func TestWASI_fd_seek_pread_pwrite(t *testing.T) {
+	vm := newTestVM()
+	fsys := MemFS()
+	w := New(Preopen("/", fsys))
+	pathOpen := w.path_open(vm).Interface().(func(uint32, uint32, uint32, uint32, uint32, uint64, uint64, uint32, uint32) uint32)
+	fdSeek := w.fd_seek(vm).Interface().(func(uint32, int64, uint32, uint32) uint32)
+	fdTell := w.fd_tell(vm).Interface().(func(uint32, uint32) uint32)
+	fdPread := w.fd_pread(vm).Interface().(func(uint32, uint32, uint32, uint64, uint32) uint32)
+	fdPwrite := w.fd_pwrite(vm).Interface().(func(uint32, uint32, uint32, uint64, uint32) uint32)
+
+	// "a" at 0, iovecs at 16 pointing to "hello" at 32 and " world" at 48
+	require.True(t, vm.Memory.Write(0, []byte("a")))
+	require.True(t, vm.Memory.Write(32, []byte("hello")))
+	require.True(t, vm.Memory.Write(48, []byte(" world")))
+	for i, v := range []uint32{32, 5, 48, 6} {
+		require.True(t, vm.Memory.WriteUint32Le(16+uint32(i)*4, v))
+	}
+
+	require.Equal(t, ESUCCESS, pathOpen(3, 0, 0, 1, O_CREATE, R_FD_READ|R_FD_WRITE, 0, 0, 8))
+	fd, _ := vm.Memory.ReadUint32Le(8)
+
+	require.Equal(t, ESUCCESS, fdPwrite(fd, 16, 2, 2, 8))
+	nwritten, _ := vm.Memory.ReadUint32Le(8)
+	assert.Equal(t, uint32(11), nwritten)
+
+	// pwrite doesn't move the position
+	require.Equal(t, ESUCCESS, fdTell(fd, 8))
+	pos, _ := vm.Memory.ReadUint64Le(8)
+	assert.Equal(t, uint64(0), pos)
+
+	require.Equal(t, ESUCCESS, fdSeek(fd, -3, 2, 8))
+	pos, _ = vm.Memory.ReadUint64Le(8)
+	assert.Equal(t, uint64(10), pos)
+	assert.Equal(t, EINVAL, fdSeek(fd, 0, 3, 8))
+	assert.Equal(t, EINVAL, fdSeek(fd, -11, 1, 8))
+
+	// wasi_unstable numbers whence as CUR, END and SET
+	fdSeekUnstable := w.fd_seek_unstable(vm).Interface().(func(uint32, int64, uint32, uint32) uint32)
+	for _, c := range []struct {
+		offset int64
+		whence uint32
+		exp    uint64
+	}{
+		{offset: 2, whence: 2, exp: 2},
+		{offset: 1, whence: 0, exp: 3},
+		{offset: -1, whence: 1, exp: 12},
+	} {
+		require.Equal(t, ESUCCESS, fdSeekUnstable(fd, c.offset, c.whence, 8))
+		pos, _ = vm.Memory.ReadUint64Le(8)
+		assert.Equal(t, c.exp, pos)
+	}
+	assert.Equal(t, EINVAL, fdSeekUnstable(fd, 0, 3, 8))
+
+	// read the file back into both iovecs, the second one is filled partially
+	require.True(t, vm.Memory.Write(32, make([]byte, 11)))
+	require.Equal(t, ESUCCESS, fdPread(fd, 16, 2, 4, 8))
+	nread, _ := vm.Memory.ReadUint32Le(8)
+	assert.Equal(t, uint32(9), nread)
+	actual, _ := vm.Memory.ReadString(32, 5)
+	assert.Equal(t, "llo w", actual)
+	actual, _ = vm.Memory.ReadString(48, 4)
+	assert.Equal(t, "orld", actual)
+
+	assert.Equal(t, EFAULT, fdTell(fd, 65532))
+	assert.Equal(t, EFAULT, fdPread(fd, 65535, 1, 0, 8))
+
+	// stdio, preopened directories and unknown files
+	assert.Equal(t, ESPIPE, fdSeek(1, 0, 0, 8))
+	assert.Equal(t, ESPIPE, fdTell(0, 8))
+	assert.Equal(t, EBADF, fdSeek(3, 0, 0, 8))
+	assert.Equal(t, EBADF, fdPread(100, 16, 2, 0, 8))
+	assert.Equal(t, EBADF, fdPwrite(3, 16, 2, 0, 8))
+}
+
+func TestWASI_filestat(t *testing.T) {
+	vm := newTestVM()
+	fsys := MemFS()
+	fsys.(*memFS).files["file"] = []byte("hello")
+	w := New(Preopen("/", fsys))
+	pathOpen := w.path_open(vm).Interface().(func(uint32, uint32, uint32, uint32, uint32, uint64, uint64, uint32, uint32) uint32)
+	fdFdstatGet := w.fd_fdstat_get(vm).Interface().(func(uint32, uint32) uint32)
+	fdFilestatGet := w.fd_filestat_get(vm).Interface().(func(uint32, uint32) uint32)
+	pathFilestatGet := w.path_filestat_get(vm).Interface().(func(uint32, uint32, uint32, uint32, uint32) uint32)
+
+	const bufPtr = 64
+	require.True(t, vm.Memory.Write(0, []byte("file")))
+	require.Equal(t, ESUCCESS, pathOpen(3, 0, 0, 4, 0, R_FD_READ|R_FD_SEEK, R_FD_READ, 1, bufPtr))
+	fd, _ := vm.Memory.ReadUint32Le(bufPtr)
+
+	t.Run("fd_fdstat_get", func(t *testing.T) {
+		for _, c := range []struct {
+			fd                       uint32
+			filetype                 byte
+			flags                    uint16
+			rights, rightsInheriting uint64
+		}{
+			{fd: 0, filetype: FILETYPE_CHARACTER_DEVICE, rights: R_FD_READ | R_POLL_FD_READWRITE},
+			{fd: 2, filetype: FILETYPE_CHARACTER_DEVICE, rights: R_FD_WRITE | R_POLL_FD_READWRITE},
+			{fd: 3, filetype: FILETYPE_DIRECTORY, rights: dirRights, rightsInheriting: dirRights | fileRights},
+			{fd: fd, filetype: FILETYPE_REGULAR_FILE, flags: 1, rights: R_FD_READ | R_FD_SEEK, rightsInheriting: R_FD_READ},
+		} {
+			require.Equal(t, ESUCCESS, fdFdstatGet(c.fd, bufPtr))
+			b, _ := vm.Memory.Read(bufPtr, 24)
+			assert.Equal(t, c.filetype, b[0])
+			assert.Equal(t, c.flags, binary.LittleEndian.Uint16(b[2:]))
+			assert.Equal(t, c.rights, binary.LittleEndian.Uint64(b[8:]))
+			assert.Equal(t, c.rightsInheriting, binary.LittleEndian.Uint64(b[16:]))
+		}
+		assert.Equal(t, EBADF, fdFdstatGet(100, bufPtr))
+		assert.Equal(t, EFAULT, fdFdstatGet(fd, 65535))
+	})
+
+	t.Run("fd_filestat_get", func(t *testing.T) {
+		for _, c := range []struct {
+			fd       uint32
+			filetype byte
+			size     uint64
+		}{
+			{fd: 1, filetype: FILETYPE_CHARACTER_DEVICE},
+			{fd: 3, filetype: FILETYPE_DIRECTORY},
+			{fd: fd, filetype: FILETYPE_REGULAR_FILE, size: 5},
+		} {
+			require.Equal(t, ESUCCESS, fdFilestatGet(c.fd, bufPtr))
+			b, _ := vm.Memory.Read(bufPtr, 64)
+			assert.Equal(t, c.filetype, b[16])
+			assert.Equal(t, uint64(1), binary.LittleEndian.Uint64(b[24:]))
+			assert.Equal(t, c.size, binary.LittleEndian.Uint64(b[32:]))
+		}
+		assert.Equal(t, EBADF, fdFilestatGet(100, bufPtr))
+		assert.Equal(t, EFAULT, fdFilestatGet(fd, 65535))
+	})
+
+	t.Run("path_filestat_get", func(t *testing.T) {
+		require.Equal(t, ESUCCESS, pathFilestatGet(3, LOOKUP_SYMLINK_FOLLOW, 0, 4, bufPtr))
+		b, _ := vm.Memory.Read(bufPtr, 64)
+		assert.Equal(t, byte(FILETYPE_REGULAR_FILE), b[16])
+		assert.Equal(t, uint64(5), binary.LittleEndian.Uint64(b[32:]))
+
+		assert.Equal(t, ENOENT, pathFilestatGet(3, 0, 0, 3, bufPtr))
+		assert.Equal(t, EFAULT, pathFilestatGet(3, 0, 65535, 4, bufPtr))
+		assert.Equal(t, EBADF, pathFilestatGet(fd, 0, 0, 4, bufPtr))
+	})
+
+	t.Run("wasi_unstable", func(t *testing.T) {
+		fdFilestatGetUnstable := w.fd_filestat_get_unstable(vm).Interface().(func(uint32, uint32) uint32)
+		pathFilestatGetUnstable := w.path_filestat_get_unstable(vm).Interface().(func(uint32, uint32, uint32, uint32, uint32) uint32)
+		for _, call := range []func() uint32{
+			func() uint32 { return fdFilestatGetUnstable(fd, bufPtr) },
+			func() uint32 { return pathFilestatGetUnstable(3, 0, 0, 4, bufPtr) },
+		} {
+			require.True(t, vm.Memory.Write(bufPtr, bytes.Repeat([]byte{0xff}, 64)))
+			require.Equal(t, ESUCCESS, call())
+			b, _ := vm.Memory.Read(bufPtr, 64)
+			assert.Equal(t, byte(FILETYPE_REGULAR_FILE), b[16])
+			assert.Equal(t, uint32(1), binary.LittleEndian.Uint32(b[20:]))
+			assert.Equal(t, uint64(5), binary.LittleEndian.Uint64(b[24:]))
+			// the filestat is 56 bytes
+			assert.Equal(t, bytes.Repeat([]byte{0xff}, 8), b[56:])
+		}
+		assert.Equal(t, EFAULT, fdFilestatGetUnstable(fd, 65536-55))
+	})
+}
+
+func TestWASI_fd_readdir(t *testing.T) {
+	vm := newTestVM()
+	fsys := MemFS().(*memFS)
+	fsys.dirs["dir"] = struct{}{}
+	fsys.files["dir/file"] = nil
+	fsys.files["a"] = []byte("a")
+	w := New(Preopen("/", fsys))
+	pathOpen := w.path_open(vm).Interface().(func(uint32, uint32, uint32, uint32, uint32, uint64, uint64, uint32, uint32) uint32)
+	fdReaddir := w.fd_readdir(vm).Interface().(func(uint32, uint32, uint32, uint64, uint32) uint32)
+
+	const bufPtr, bufUsedPtr = 64, 8
+	readdir := func(fd, bufLen uint32, cookie uint64) []byte {
+		require.Equal(t, ESUCCESS, fdReaddir(fd, bufPtr, bufLen, cookie, bufUsedPtr))
+		bufUsed, _ := vm.Memory.ReadUint32Le(bufUsedPtr)
+		b, _ := vm.Memory.Read(bufPtr, bufUsed)
+		return b
+	}
+	dirent := func(next uint64, name string, filetype byte) []byte {
+		b := make([]byte, 24+len(name))
+		binary.LittleEndian.PutUint64(b, next)
+		binary.LittleEndian.PutUint32(b[16:], uint32(len(name)))
+		b[20] = filetype
+		copy(b[24:], name)
+		return b
+	}
+	direntA, direntDir := dirent(1, "a", FILETYPE_REGULAR_FILE), dirent(2, "dir", FILETYPE_DIRECTORY)
+
+	assert.Equal(t, append(append([]byte{}, direntA...), direntDir...), readdir(3, 256, 0))
+	// resume from the cookie
+	assert.Equal(t, direntDir, readdir(3, 256, 1))
+	assert.Empty(t, readdir(3, 256, 2))
+	assert.Empty(t, readdir(3, 256, 100))
+	// the last entry is truncated if the buffer is too small
+	assert.Equal(t, append(append([]byte{}, direntA...), direntDir[:10]...), readdir(3, 35, 0))
+
+	// directories opened with path_open
+	require.True(t, vm.Memory.Write(0, []byte("dir")))
+	require.Equal(t, ESUCCESS, pathOpen(3, 0, 0, 3, O_DIR, R_FD_READDIR, 0, 0, 16))
+	fd, _ := vm.Memory.ReadUint32Le(16)
+	assert.Equal(t, dirent(1, "file", FILETYPE_REGULAR_FILE), readdir(fd, 256, 0))
+
+	// opening the root doesn't change its listing
+	require.True(t, vm.Memory.Write(0, []byte(".")))
+	require.Equal(t, ESUCCESS, pathOpen(3, 0, 0, 1, O_DIR, R_FD_READDIR, 0, 0, 16))
+	fd, _ = vm.Memory.ReadUint32Le(16)
+	assert.Equal(t, append(append([]byte{}, direntA...), direntDir...), readdir(fd, 256, 0))
+	assert.Equal(t, append(append([]byte{}, direntA...), direntDir...), readdir(3, 256, 0))
+
+	// path_open doesn't create directories
+	require.True(t, vm.Memory.Write(0, []byte("new")))
+	assert.Equal(t, EINVAL, pathOpen(3, 0, 0, 3, O_CREATE|O_DIR, R_FD_READDIR, 0, 0, 16))
+	_, err := fsys.StatWASI(0, "new")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	require.True(t, vm.Memory.Write(0, []byte("a")))
+	require.Equal(t, ESUCCESS, pathOpen(3, 0, 0, 1, 0, R_FD_READ, 0, 0, 16))
+	fd, _ = vm.Memory.ReadUint32Le(16)
+	assert.Equal(t, ENOTDIR, fdReaddir(fd, bufPtr, 256, 0, bufUsedPtr))
+	assert.Equal(t, ENOTDIR, fdReaddir(1, bufPtr, 256, 0, bufUsedPtr))
+	assert.Equal(t, EBADF, fdReaddir(100, bufPtr, 256, 0, bufUsedPtr))
+	assert.Equal(t, EFAULT, fdReaddir(3, 65535, 256, 0, bufUsedPtr))
+}
+
+func TestWASI_fd_prestat_dir_name(t *testing.T) {
+	vm := newTestVM()
+	w := New(Preopen("/tmp", MemFS()))
+	prestatGet := w.fd_prestat_get(vm).Interface().(func(uint32, uint32) uint32)
+	dirName := w.fd_prestat_dir_name(vm).Interface().(func(uint32, uint32, uint32) uint32)
+
+	require.True(t, vm.Memory.Write(16, []byte{0xff}))
+	require.Equal(t, ESUCCESS, prestatGet(3, 16))
+	tag, _ := vm.Memory.Read(16, 1)
+	assert.Equal(t, []byte{0}, tag)
+	nameLen, _ := vm.Memory.ReadUint32Le(20)
+	assert.Equal(t, uint32(4), nameLen)
+	assert.Equal(t, EBADF, prestatGet(4, 16))
+	assert.Equal(t, EFAULT, prestatGet(3, 65532))
+
+	// the buffer is too small and left untouched
+	assert.Equal(t, ENAMETOOLONG, dirName(3, 0, 3))
+	b, _ := vm.Memory.Read(0, 4)
+	assert.Equal(t, make([]byte, 4), b)
+
+	require.Equal(t, ESUCCESS, dirName(3, 0, 4))
+	actual, _ := vm.Memory.ReadString(0, 4)
+	assert.Equal(t, "/tmp", actual)
+
+	assert.Equal(t, EBADF, dirName(4, 0, 4))
+
+	// files opened with path_open aren't preopens
+	pathOpen := w.path_open(vm).Interface().(func(uint32, uint32, uint32, uint32, uint32, uint64, uint64, uint32, uint32) uint32)
+	require.True(t, vm.Memory.Write(0, []byte("a")))
+	require.Equal(t, ESUCCESS, pathOpen(3, 0, 0, 1, O_CREATE, R_FD_WRITE, 0, 0, 8))
+	fd, _ := vm.Memory.ReadUint32Le(8)
+	assert.Equal(t, EBADF, prestatGet(fd, 16))
+	assert.Equal(t, EBADF, dirName(fd, 32, 4))
+}
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errors.New("closed")
+}
+
+func TestWASI_fd_write(t *testing.T) {
+	vm := newTestVM()
+	stdout := new(bytes.Buffer)
+	w := New(Stdout(stdout), Stderr(errWriter{}))
+	fdWrite := w.fd_write(vm).Interface().(func(uint32, uint32, uint32, uint32) uint32)
+
+	// an iovec at 0 pointing to "hi" at 16
+	require.True(t, vm.Memory.WriteUint32Le(0, 16))
+	require.True(t, vm.Memory.WriteUint32Le(4, 2))
+	require.True(t, vm.Memory.Write(16, []byte("hi")))
+
+	require.Equal(t, ESUCCESS, fdWrite(1, 0, 1, 8))
+	nwritten, _ := vm.Memory.ReadUint32Le(8)
+	assert.Equal(t, uint32(2), nwritten)
+	assert.Equal(t, "hi", stdout.String())
+
+	assert.Equal(t, EIO, fdWrite(2, 0, 1, 8))
+	assert.Equal(t, EBADF, fdWrite(100, 0, 1, 8))
+}
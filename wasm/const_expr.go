@@ -10,90 +10,248 @@ import (
 	"github.com/mathetake/gasm/wasm/leb128"
 )
 
+// ConstantExpression holds the instruction sequence of a constant expression
+// (without the terminating end instruction). In addition to a single constant,
+// the extended-const proposal allows sequences like `global.get 0; i32.const 8; i32.add`.
 type ConstantExpression struct {
-	optCode OptCode
-	data    []byte
+	data []byte
+}
+
+// reference is the value of ref.null and ref.func instructions.
+type reference struct {
+	valueType ValueType
+	funcIndex *uint32 // nil for null references
 }
 
 func (m *Module) executeConstExpression(expr *ConstantExpression) (v interface{}, err error) {
-	r := bytes.NewBuffer(expr.data)
-	switch expr.optCode {
-	case OptCodeI32Const:
-		v, _, err = leb128.DecodeInt32(r)
-		if err != nil {
-			return nil, fmt.Errorf("read int32: %w", err)
+	r := bytes.NewReader(expr.data)
+	stack := make([]interface{}, 0, 2)
+	for r.Len() > 0 {
+		b, _ := r.ReadByte()
+		switch optCode := OptCode(b); optCode {
+		case OptCodeI32Const:
+			v, _, err = leb128.DecodeInt32(r)
+			if err != nil {
+				return nil, fmt.Errorf("read int32: %w", err)
+			}
+		case OptCodeI64Const:
+			v, _, err = leb128.DecodeInt64(r)
+			if err != nil {
+				return nil, fmt.Errorf("read int64: %w", err)
+			}
+		case OptCodeF32Const:
+			v, err = readFloat32(r)
+			if err != nil {
+				return nil, fmt.Errorf("read f32: %w", err)
+			}
+		case OptCodeF64Const:
+			v, err = readFloat64(r)
+			if err != nil {
+				return nil, fmt.Errorf("read f64: %w", err)
+			}
+		case OptCodeGlobalGet:
+			id, _, err := leb128.DecodeUint32(r)
+			if err != nil {
+				return nil, fmt.Errorf("read index of global: %w", err)
+			}
+			if uint32(len(m.IndexSpace.Globals)) <= id {
+				return nil, fmt.Errorf("global index out of range")
+			}
+			g := m.IndexSpace.Globals[id]
+			if g.Type.Mutable {
+				return nil, fmt.Errorf("global %d is mutable and cannot be used in constant expressions", id)
+			}
+			v = constValueFromRaw(g.Val, g.Type.Value)
+		case OptCodeRefNull:
+			vt, err := readReferenceType(r)
+			if err != nil {
+				return nil, fmt.Errorf("read reference type: %w", err)
+			}
+			v = reference{valueType: vt}
+		case OptCodeRefFunc:
+			id, _, err := leb128.DecodeUint32(r)
+			if err != nil {
+				return nil, fmt.Errorf("read index of function: %w", err)
+			}
+			if uint32(len(m.IndexSpace.Function)) <= id {
+				return nil, fmt.Errorf("function index out of range")
+			}
+			v = reference{valueType: ValueTypeFuncref, funcIndex: &id}
+		case OptCodeI32add, OptCodeI32sub, OptCodeI32mul,
+			OptCodeI64add, OptCodeI64sub, OptCodeI64mul:
+			if len(stack) < 2 {
+				return nil, fmt.Errorf("stack underflow on %#x", optCode)
+			}
+			x1, x2 := stack[len(stack)-2], stack[len(stack)-1]
+			stack = stack[:len(stack)-2]
+			v, err = executeConstBinaryOp(optCode, x1, x2)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("invalid opt code: %#x", optCode)
 		}
-	case OptCodeI64Const:
-		v, _, err = leb128.DecodeInt64(r)
-		if err != nil {
-			return nil, fmt.Errorf("read int64: %w", err)
+		stack = append(stack, v)
+	}
+
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("constant expression must leave exactly one value but got %d", len(stack))
+	}
+	return stack[0], nil
+}
+
+func executeConstBinaryOp(optCode OptCode, x1, x2 interface{}) (interface{}, error) {
+	switch optCode {
+	case OptCodeI32add, OptCodeI32sub, OptCodeI32mul:
+		a, ok1 := x1.(int32)
+		b, ok2 := x2.(int32)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("type mismatch on %#x: operands must be i32", optCode)
 		}
-	case OptCodeF32Const:
-		v, err = readFloat32(r)
-		if err != nil {
-			return nil, fmt.Errorf("read f34: %w", err)
+		switch optCode {
+		case OptCodeI32add:
+			return a + b, nil
+		case OptCodeI32sub:
+			return a - b, nil
+		default:
+			return a * b, nil
 		}
-	case OptCodeF64Const:
-		v, err = readFloat64(r)
-		if err != nil {
-			return nil, fmt.Errorf("read f64: %w", err)
+	default:
+		a, ok1 := x1.(int64)
+		b, ok2 := x2.(int64)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("type mismatch on %#x: operands must be i64", optCode)
 		}
-	case OptCodeGlobalGet:
-		id, _, err := leb128.DecodeUint32(r)
-		if err != nil {
-			return nil, fmt.Errorf("read index of global: %w", err)
+		switch optCode {
+		case OptCodeI64add:
+			return a + b, nil
+		case OptCodeI64sub:
+			return a - b, nil
+		default:
+			return a * b, nil
 		}
-		if uint32(len(m.IndexSpace.Globals)) <= id {
-			return nil, fmt.Errorf("global index out of range")
+	}
+}
+
+// constValueType returns the value type of the result of executeConstExpression.
+func constValueType(v interface{}) (ValueType, error) {
+	switch v := v.(type) {
+	case int32:
+		return ValueTypeI32, nil
+	case int64:
+		return ValueTypeI64, nil
+	case float32:
+		return ValueTypeF32, nil
+	case float64:
+		return ValueTypeF64, nil
+	case reference:
+		return v.valueType, nil
+	default:
+		return 0, fmt.Errorf("invalid constant value: %v", v)
+	}
+}
+
+// rawConstValue encodes the result of executeConstExpression as it is on the operand stack.
+func rawConstValue(v interface{}) uint64 {
+	switch v := v.(type) {
+	case int32:
+		return uint64(v)
+	case int64:
+		return uint64(v)
+	case float32:
+		return uint64(math.Float32bits(v))
+	case float64:
+		return math.Float64bits(v)
+	case reference:
+		if v.funcIndex == nil {
+			return refNull
 		}
-		v = m.IndexSpace.Globals[id].Val
+		return uint64(*v.funcIndex)
+	}
+	return 0
+}
+
+// constValueFromRaw is the inverse of rawConstValue.
+func constValueFromRaw(raw uint64, vt ValueType) interface{} {
+	switch vt {
+	case ValueTypeI32:
+		return int32(raw)
+	case ValueTypeI64:
+		return int64(raw)
+	case ValueTypeF32:
+		return math.Float32frombits(uint32(raw))
+	case ValueTypeF64:
+		return math.Float64frombits(raw)
 	default:
-		return nil, fmt.Errorf("invalid opt code: %#x", expr.optCode)
+		ref := reference{valueType: vt}
+		if raw != refNull {
+			idx := uint32(raw)
+			ref.funcIndex = &idx
+		}
+		return ref
 	}
-	return v, nil
 }
 
 func readConstantExpression(r io.Reader) (*ConstantExpression, error) {
-	b := make([]byte, 1)
-	_, err := io.ReadFull(r, b)
-	if err != nil {
-		return nil, fmt.Errorf("read optcode: %w", err)
-	}
 	buf := new(bytes.Buffer)
 	teeR := io.TeeReader(r, buf)
 
-	optCode := OptCode(b[0])
-	switch optCode {
-	case OptCodeI32Const:
-		_, _, err = leb128.DecodeInt32(teeR)
-	case OptCodeI64Const:
-		_, _, err = leb128.DecodeInt64(teeR)
-	case OptCodeF32Const:
-		_, err = readFloat32(teeR)
-	case OptCodeF64Const:
-		_, err = readFloat64(teeR)
-	case OptCodeGlobalGet:
-		_, _, err = leb128.DecodeUint32(teeR)
-	default:
-		return nil, fmt.Errorf("%w for opt code: %#x", ErrInvalidByte, b[0])
+	b := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, fmt.Errorf("read optcode: %w", err)
+		}
+
+		optCode := OptCode(b[0])
+		if optCode == OptCodeEnd {
+			break
+		}
+		buf.WriteByte(b[0])
+
+		var err error
+		switch optCode {
+		case OptCodeI32Const:
+			_, _, err = leb128.DecodeInt32(teeR)
+		case OptCodeI64Const:
+			_, _, err = leb128.DecodeInt64(teeR)
+		case OptCodeF32Const:
+			_, err = readFloat32(teeR)
+		case OptCodeF64Const:
+			_, err = readFloat64(teeR)
+		case OptCodeGlobalGet, OptCodeRefFunc:
+			_, _, err = leb128.DecodeUint32(teeR)
+		case OptCodeRefNull:
+			_, err = readReferenceType(teeR)
+		case OptCodeI32add, OptCodeI32sub, OptCodeI32mul,
+			OptCodeI64add, OptCodeI64sub, OptCodeI64mul:
+		default:
+			return nil, fmt.Errorf("%w for opt code: %#x", ErrInvalidByte, b[0])
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("read value: %w", err)
+		}
 	}
 
-	if err != nil {
-		return nil, fmt.Errorf("read value: %w", err)
+	if buf.Len() == 0 {
+		return nil, fmt.Errorf("constant expression is empty")
 	}
 
+	return &ConstantExpression{data: buf.Bytes()}, nil
+}
+
+func readReferenceType(r io.Reader) (ValueType, error) {
+	b := make([]byte, 1)
 	if _, err := io.ReadFull(r, b); err != nil {
-		return nil, fmt.Errorf("look for end optcode: %w", err)
+		return 0, err
 	}
 
-	if b[0] != byte(OptCodeEnd) {
-		return nil, fmt.Errorf("constant expression has not terminated")
+	switch vt := ValueType(b[0]); vt {
+	case ValueTypeFuncref, ValueTypeExternref:
+		return vt, nil
+	default:
+		return 0, fmt.Errorf("%w for reference type: %#x", ErrInvalidByte, b[0])
 	}
-
-	return &ConstantExpression{
-		optCode: optCode,
-		data:    buf.Bytes(),
-	}, nil
 }
 
 // IEEE 754
@@ -13,8 +13,14 @@ import (
 func TestModule_executeConstExpression(t *testing.T) {
 	t.Run("error", func(t *testing.T) {
 		for _, expr := range []*ConstantExpression{
-			{optCode: 0xa},
-			{optCode: OptCodeGlobalGet, data: []byte{0x2}},
+			{data: []byte{0xa}},
+			{data: []byte{byte(OptCodeGlobalGet), 0x2}},
+			{data: []byte{byte(OptCodeI32Const), 0x1, byte(OptCodeI32Const), 0x2}},
+			{data: []byte{byte(OptCodeI32Const), 0x1, byte(OptCodeI32add)}},
+			{data: []byte{byte(OptCodeI32Const), 0x1, byte(OptCodeI64Const), 0x2, byte(OptCodeI32add)}},
+			{data: []byte{byte(OptCodeI64Const), 0x1, byte(OptCodeI64Const), 0x2, byte(OptCodeI32mul)}},
+			{data: []byte{byte(OptCodeRefFunc), 0x0}},
+			{data: []byte{byte(OptCodeRefNull), 0x7f}},
 		} {
 			m := &Module{IndexSpace: new(ModuleIndexSpace)}
 			_, err := m.executeConstExpression(expr)
@@ -31,33 +37,65 @@ func TestModule_executeConstExpression(t *testing.T) {
 		}{
 			{
 				expr: &ConstantExpression{
-					optCode: OptCodeI64Const,
-					data:    []byte{0x5},
+					data: []byte{byte(OptCodeI64Const), 0x5},
 				},
 				val: int64(5),
 			},
 			{
 				expr: &ConstantExpression{
-					optCode: OptCodeI32Const,
-					data:    []byte{0x5},
+					data: []byte{byte(OptCodeI32Const), 0x5},
 				},
 				val: int32(5),
 			},
 			{
 				expr: &ConstantExpression{
-					optCode: OptCodeF32Const,
-					data:    []byte{0x40, 0xe1, 0x47, 0x40},
+					data: []byte{byte(OptCodeF32Const), 0x40, 0xe1, 0x47, 0x40},
 				},
 				val: float32(3.1231232),
 			},
 			{
 				expr: &ConstantExpression{
-					optCode: OptCodeF64Const,
-					data:    []byte{0x5e, 0xc4, 0xd8, 0xf9, 0x27, 0xfc, 0x08, 0x40},
+					data: []byte{byte(OptCodeF64Const), 0x5e, 0xc4, 0xd8, 0xf9, 0x27, 0xfc, 0x08, 0x40},
 				},
 				val: 3.1231231231,
 			},
+			{
+				expr: &ConstantExpression{data: []byte{
+					byte(OptCodeI32Const), 0x5, byte(OptCodeI32Const), 0x3, byte(OptCodeI32sub),
+					byte(OptCodeI32Const), 0x4, byte(OptCodeI32mul),
+				}},
+				val: int32(8),
+			},
+			{
+				expr: &ConstantExpression{data: []byte{
+					byte(OptCodeI64Const), 0x7f, byte(OptCodeI64Const), 0x3, byte(OptCodeI64add),
+				}},
+				val: int64(2),
+			},
+			{
+				m: Module{IndexSpace: &ModuleIndexSpace{Globals: []*Global{
+					{Type: &GlobalType{Value: ValueTypeI32}, Val: 1024},
+				}}},
+				expr: &ConstantExpression{data: []byte{
+					byte(OptCodeGlobalGet), 0x0, byte(OptCodeI32Const), 0x10, byte(OptCodeI32add),
+				}},
+				val: int32(1040),
+			},
+			{
+				expr: &ConstantExpression{data: []byte{byte(OptCodeRefNull), byte(ValueTypeExternref)}},
+				val:  reference{valueType: ValueTypeExternref},
+			},
+			{
+				m: Module{IndexSpace: &ModuleIndexSpace{Function: []VirtualMachineFunction{
+					&NativeFunction{}, &NativeFunction{},
+				}}},
+				expr: &ConstantExpression{data: []byte{byte(OptCodeRefFunc), 0x1}},
+				val:  reference{valueType: ValueTypeFuncref, funcIndex: uint32Ptr(1)},
+			},
 		} {
+			if c.m.IndexSpace == nil {
+				c.m.IndexSpace = new(ModuleIndexSpace)
+			}
 
 			actual, err := c.m.executeConstExpression(c.expr)
 			require.NoError(t, err)
@@ -69,7 +107,7 @@ func TestModule_executeConstExpression(t *testing.T) {
 func TestReadConstantExpression(t *testing.T) {
 	t.Run("error", func(t *testing.T) {
 		for _, b := range [][]byte{
-			{}, {0xaa}, {0x41, 0x1}, {0x41, 0x1, 0x41},
+			{}, {0xaa}, {0x41, 0x1}, {0x41, 0x1, 0x41}, {0x0b}, {0x41, 0x1, 0x45, 0x0b}, {0xd0, 0x7f, 0x0b},
 		} {
 			_, err := readConstantExpression(bytes.NewBuffer(b))
 			assert.Error(t, err)
@@ -84,15 +122,29 @@ func TestReadConstantExpression(t *testing.T) {
 		}{
 			{
 				bytes: []byte{0x42, 0x01, 0x0b},
-				exp:   &ConstantExpression{optCode: OptCodeI64Const, data: []byte{0x01}},
+				exp:   &ConstantExpression{data: []byte{byte(OptCodeI64Const), 0x01}},
 			},
 			{
 				bytes: []byte{0x43, 0x40, 0xe1, 0x47, 0x40, 0x0b},
-				exp:   &ConstantExpression{optCode: OptCodeF32Const, data: []byte{0x40, 0xe1, 0x47, 0x40}},
+				exp:   &ConstantExpression{data: []byte{byte(OptCodeF32Const), 0x40, 0xe1, 0x47, 0x40}},
 			},
 			{
 				bytes: []byte{0x23, 0x01, 0x0b},
-				exp:   &ConstantExpression{optCode: OptCodeGlobalGet, data: []byte{0x01}},
+				exp:   &ConstantExpression{data: []byte{byte(OptCodeGlobalGet), 0x01}},
+			},
+			{
+				bytes: []byte{0x23, 0x01, 0x41, 0x80, 0x01, 0x6a, 0x0b},
+				exp: &ConstantExpression{data: []byte{
+					byte(OptCodeGlobalGet), 0x01, byte(OptCodeI32Const), 0x80, 0x01, byte(OptCodeI32add),
+				}},
+			},
+			{
+				bytes: []byte{0xd0, 0x70, 0x0b},
+				exp:   &ConstantExpression{data: []byte{byte(OptCodeRefNull), byte(ValueTypeFuncref)}},
+			},
+			{
+				bytes: []byte{0xd2, 0x02, 0x0b},
+				exp:   &ConstantExpression{data: []byte{byte(OptCodeRefFunc), 0x02}},
 			},
 		} {
 			actual, err := readConstantExpression(bytes.NewBuffer(c.bytes))
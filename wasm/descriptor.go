@@ -0,0 +1,139 @@
+package wasm
+
+import (
+	"fmt"
+	"sort"
+)
+
+type (
+	// ExportDescriptor describes an export of a module with its type.
+	// Only the type matching Kind is set.
+	ExportDescriptor struct {
+		Name string
+		Kind byte
+
+		FunctionType *FunctionType
+		Table        *TableType
+		Memory       *MemoryType
+		Global       *GlobalType
+	}
+
+	// moduleTypes holds the types of the index spaces including the imported entries.
+	moduleTypes struct {
+		functions []*FunctionType
+		tables    []*TableType
+		memories  []*MemoryType
+		globals   []*GlobalType
+	}
+)
+
+// Imports returns the imports of the module in the order of the import section.
+func (m *Module) Imports() ([]*ImportDescriptor, error) {
+	ret := make([]*ImportDescriptor, 0, len(m.SecImports))
+	for _, is := range m.SecImports {
+		desc, err := m.importDescriptor(is)
+		if err != nil {
+			return nil, fmt.Errorf("import %s.%s: %w", is.Module, is.Name, err)
+		}
+		ret = append(ret, desc)
+	}
+	return ret, nil
+}
+
+// Exports returns the exports of the module sorted by their names.
+func (m *Module) Exports() ([]*ExportDescriptor, error) {
+	types, err := m.types()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*ExportDescriptor, 0, len(m.SecExports))
+	for name, es := range m.SecExports {
+		desc := &ExportDescriptor{Name: name, Kind: es.Desc.Kind}
+		idx := es.Desc.Index
+		switch es.Desc.Kind {
+		case ExportKindFunction:
+			if idx < uint32(len(types.functions)) {
+				desc.FunctionType = types.functions[idx]
+			}
+		case ExportKindTable:
+			if idx < uint32(len(types.tables)) {
+				desc.Table = types.tables[idx]
+			}
+		case ExportKindMem:
+			if idx < uint32(len(types.memories)) {
+				desc.Memory = types.memories[idx]
+			}
+		case ExportKindGlobal:
+			if idx < uint32(len(types.globals)) {
+				desc.Global = types.globals[idx]
+			}
+		default:
+			return nil, fmt.Errorf("export %s: invalid kind %#x", name, es.Desc.Kind)
+		}
+
+		if desc.FunctionType == nil && desc.Table == nil && desc.Memory == nil && desc.Global == nil {
+			return nil, fmt.Errorf("export %s: index out of range", name)
+		}
+		ret = append(ret, desc)
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret, nil
+}
+
+// types returns the types of the module's index spaces: the imported entries followed by
+// the ones defined in the sections. Entries only present in the index space, such as the
+// ones of modules built by the host, are taken from the instances.
+func (m *Module) types() (*moduleTypes, error) {
+	ret := new(moduleTypes)
+	for _, is := range m.SecImports {
+		desc, err := m.importDescriptor(is)
+		if err != nil {
+			return nil, fmt.Errorf("import %s.%s: %w", is.Module, is.Name, err)
+		}
+		switch desc.Kind {
+		case ExportKindFunction:
+			ret.functions = append(ret.functions, desc.FunctionType)
+		case ExportKindTable:
+			ret.tables = append(ret.tables, desc.Table)
+		case ExportKindMem:
+			ret.memories = append(ret.memories, desc.Memory)
+		case ExportKindGlobal:
+			ret.globals = append(ret.globals, desc.Global)
+		}
+	}
+
+	for _, idx := range m.SecFunctions {
+		if idx >= uint32(len(m.SecTypes)) {
+			return nil, fmt.Errorf("type index out of range")
+		}
+		ret.functions = append(ret.functions, m.SecTypes[idx])
+	}
+	ret.tables = append(ret.tables, m.SecTables...)
+	ret.memories = append(ret.memories, m.SecMemory...)
+	for _, gs := range m.SecGlobals {
+		ret.globals = append(ret.globals, gs.Type)
+	}
+
+	if is := m.IndexSpace; is != nil {
+		for i := len(ret.functions); i < len(is.Function); i++ {
+			ret.functions = append(ret.functions, is.Function[i].FunctionType())
+		}
+		for i := len(ret.tables); i < len(is.Table); i++ {
+			t := is.Table[i]
+			ret.tables = append(ret.tables, &TableType{
+				Elem:  byte(ValueTypeFuncref),
+				Limit: &LimitsType{Min: uint32(len(t.Elements)), Max: t.Max},
+			})
+		}
+		for i := len(ret.memories); i < len(is.Memory); i++ {
+			mem := is.Memory[i]
+			ret.memories = append(ret.memories, &MemoryType{Min: mem.Size(), Max: mem.Max})
+		}
+		for i := len(ret.globals); i < len(is.Globals); i++ {
+			ret.globals = append(ret.globals, is.Globals[i].Type)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,90 @@
+package wasm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModule_ImportsExports(t *testing.T) {
+	types := []*FunctionType{
+		{InputTypes: []ValueType{ValueTypeI32}},
+		{ReturnTypes: []ValueType{ValueTypeF64}},
+	}
+	importedTable := &TableType{Elem: 0x70, Limit: &LimitsType{Min: 1}}
+	definedMemory := &MemoryType{Min: 1, Max: uint32Ptr(2)}
+	importedGlobal := &GlobalType{Value: ValueTypeI64, Mutable: true}
+	definedGlobal := &GlobalType{Value: ValueTypeF32}
+
+	m := &Module{
+		SecTypes: types,
+		SecImports: []*ImportSegment{
+			{Module: "env", Name: "f", Desc: &ImportDesc{Kind: ExportKindFunction, TypeIndexPtr: uint32Ptr(1)}},
+			{Module: "env", Name: "table", Desc: &ImportDesc{Kind: ExportKindTable, TableTypePtr: importedTable}},
+			{Module: "env", Name: "g", Desc: &ImportDesc{Kind: ExportKindGlobal, GlobalTypePtr: importedGlobal}},
+		},
+		SecFunctions: []uint32{0},
+		SecMemory:    []*MemoryType{definedMemory},
+		SecGlobals:   []*GlobalSegment{{Type: definedGlobal}},
+		SecExports: map[string]*ExportSegment{
+			"reexported_f": {Name: "reexported_f", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 0}},
+			"defined_f":    {Name: "defined_f", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 1}},
+			"table":        {Name: "table", Desc: &ExportDesc{Kind: ExportKindTable, Index: 0}},
+			"memory":       {Name: "memory", Desc: &ExportDesc{Kind: ExportKindMem, Index: 0}},
+			"imported_g":   {Name: "imported_g", Desc: &ExportDesc{Kind: ExportKindGlobal, Index: 0}},
+			"defined_g":    {Name: "defined_g", Desc: &ExportDesc{Kind: ExportKindGlobal, Index: 1}},
+		},
+	}
+
+	imports, err := m.Imports()
+	require.NoError(t, err)
+	assert.Equal(t, []*ImportDescriptor{
+		{Module: "env", Name: "f", Kind: ExportKindFunction, FunctionType: types[1]},
+		{Module: "env", Name: "table", Kind: ExportKindTable, Table: importedTable},
+		{Module: "env", Name: "g", Kind: ExportKindGlobal, Global: importedGlobal},
+	}, imports)
+
+	exports, err := m.Exports()
+	require.NoError(t, err)
+	assert.Equal(t, []*ExportDescriptor{
+		{Name: "defined_f", Kind: ExportKindFunction, FunctionType: types[0]},
+		{Name: "defined_g", Kind: ExportKindGlobal, Global: definedGlobal},
+		{Name: "imported_g", Kind: ExportKindGlobal, Global: importedGlobal},
+		{Name: "memory", Kind: ExportKindMem, Memory: definedMemory},
+		{Name: "reexported_f", Kind: ExportKindFunction, FunctionType: types[1]},
+		{Name: "table", Kind: ExportKindTable, Table: importedTable},
+	}, exports)
+
+	t.Run("host module", func(t *testing.T) {
+		sig := &FunctionType{ReturnTypes: []ValueType{ValueTypeI32}}
+		host := &Module{
+			SecExports: map[string]*ExportSegment{
+				"f":      {Name: "f", Desc: &ExportDesc{Kind: ExportKindFunction}},
+				"memory": {Name: "memory", Desc: &ExportDesc{Kind: ExportKindMem}},
+			},
+			IndexSpace: &ModuleIndexSpace{
+				Function: []VirtualMachineFunction{&HostFunction{Signature: sig}},
+				Memory:   []*Memory{NewMemory(2, nil)},
+			},
+		}
+		exports, err := host.Exports()
+		require.NoError(t, err)
+		assert.Equal(t, []*ExportDescriptor{
+			{Name: "f", Kind: ExportKindFunction, FunctionType: sig},
+			{Name: "memory", Kind: ExportKindMem, Memory: &MemoryType{Min: 2}},
+		}, exports)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		for _, m := range []*Module{
+			{SecImports: []*ImportSegment{{Desc: &ImportDesc{Kind: ExportKindFunction, TypeIndexPtr: uint32Ptr(0)}}}},
+			{SecFunctions: []uint32{0}},
+			{SecExports: map[string]*ExportSegment{"a": {Desc: &ExportDesc{Kind: ExportKindMem}}}},
+			{SecExports: map[string]*ExportSegment{"a": {Desc: &ExportDesc{Kind: 0x10}}}},
+		} {
+			_, err := m.Exports()
+			assert.Error(t, err)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package wasm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// MaxMemoryPages is the maximum number of pages of a 32-bit linear memory.
+const MaxMemoryPages = 65536
+
+// Memory is a linear memory instance. It is shared by reference between the host,
+// the exporting module and the importing modules so that memory.grow in one of
+// them is visible in all. Host code must not retain the slice returned by Bytes
+// across calls into the guest since growing the memory reallocates it.
+type Memory struct {
+	Buffer []byte
+	// Max is the maximum number of pages; nil means no maximum
+	Max *uint32
+}
+
+// NewMemory allocates a memory of min pages.
+func NewMemory(min uint32, max *uint32) *Memory {
+	return &Memory{Buffer: make([]byte, uint64(min)*vmPageSize), Max: max}
+}
+
+// Bytes returns the current buffer of the memory.
+func (m *Memory) Bytes() []byte {
+	return m.Buffer
+}
+
+// Size returns the current size of the memory in pages.
+func (m *Memory) Size() uint32 {
+	return uint32(len(m.Buffer) / vmPageSize)
+}
+
+// Grow grows the memory by delta pages and returns the previous size in pages.
+// ok is false if the result exceeds the maximum, in which case the memory is left unchanged.
+func (m *Memory) Grow(delta uint32) (previous uint32, ok bool) {
+	previous = m.Size()
+	max := uint64(MaxMemoryPages)
+	if m.Max != nil {
+		max = uint64(*m.Max)
+	}
+
+	if uint64(previous)+uint64(delta) > max {
+		return previous, false
+	}
+
+	m.Buffer = append(m.Buffer, make([]byte, uint64(delta)*vmPageSize)...)
+	return previous, true
+}
+
+// hasSize returns true if the range [offset, offset+length) is within the memory.
+func (m *Memory) hasSize(offset uint32, length uint64) bool {
+	return m != nil && uint64(offset)+length <= uint64(len(m.Buffer))
+}
+
+// Read returns the length bytes at offset, or false if the range is out of bounds.
+// The returned slice shares the memory's buffer, so writes to it are visible to the guest.
+func (m *Memory) Read(offset, length uint32) ([]byte, bool) {
+	if !m.hasSize(offset, uint64(length)) {
+		return nil, false
+	}
+	end := uint64(offset) + uint64(length)
+	return m.Buffer[offset:end:end], true
+}
+
+// Write copies b into the memory at offset, or returns false without writing anything
+// if the range is out of bounds.
+func (m *Memory) Write(offset uint32, b []byte) bool {
+	if !m.hasSize(offset, uint64(len(b))) {
+		return false
+	}
+	copy(m.Buffer[offset:], b)
+	return true
+}
+
+// ReadString returns the string of length bytes at offset.
+func (m *Memory) ReadString(offset, length uint32) (string, bool) {
+	b, ok := m.Read(offset, length)
+	if !ok {
+		return "", false
+	}
+	return string(b), true
+}
+
+// ReadCString returns the NUL-terminated string at offset without the terminator.
+func (m *Memory) ReadCString(offset uint32) (string, bool) {
+	if !m.hasSize(offset, 0) {
+		return "", false
+	}
+	b := m.Buffer[offset:]
+	n := bytes.IndexByte(b, 0)
+	if n < 0 {
+		return "", false
+	}
+	return string(b[:n]), true
+}
+
+func (m *Memory) ReadUint32Le(offset uint32) (uint32, bool) {
+	if !m.hasSize(offset, 4) {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(m.Buffer[offset:]), true
+}
+
+func (m *Memory) WriteUint32Le(offset, v uint32) bool {
+	if !m.hasSize(offset, 4) {
+		return false
+	}
+	binary.LittleEndian.PutUint32(m.Buffer[offset:], v)
+	return true
+}
+
+func (m *Memory) ReadUint64Le(offset uint32) (uint64, bool) {
+	if !m.hasSize(offset, 8) {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(m.Buffer[offset:]), true
+}
+
+func (m *Memory) WriteUint64Le(offset uint32, v uint64) bool {
+	if !m.hasSize(offset, 8) {
+		return false
+	}
+	binary.LittleEndian.PutUint64(m.Buffer[offset:], v)
+	return true
+}
+
+func (m *Memory) ReadFloat32Le(offset uint32) (float32, bool) {
+	v, ok := m.ReadUint32Le(offset)
+	return math.Float32frombits(v), ok
+}
+
+func (m *Memory) WriteFloat32Le(offset uint32, v float32) bool {
+	return m.WriteUint32Le(offset, math.Float32bits(v))
+}
+
+func (m *Memory) ReadFloat64Le(offset uint32) (float64, bool) {
+	v, ok := m.ReadUint64Le(offset)
+	return math.Float64frombits(v), ok
+}
+
+func (m *Memory) WriteFloat64Le(offset uint32, v float64) bool {
+	return m.WriteUint64Le(offset, math.Float64bits(v))
+}
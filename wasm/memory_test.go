@@ -0,0 +1,190 @@
+package wasm
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory_Grow(t *testing.T) {
+	m := NewMemory(1, uint32Ptr(3))
+	require.Equal(t, uint32(1), m.Size())
+	require.Len(t, m.Bytes(), vmPageSize)
+
+	prev, ok := m.Grow(2)
+	require.True(t, ok)
+	assert.Equal(t, uint32(1), prev)
+	assert.Equal(t, uint32(3), m.Size())
+
+	prev, ok = m.Grow(1)
+	require.False(t, ok)
+	assert.Equal(t, uint32(3), prev)
+	assert.Equal(t, uint32(3), m.Size())
+
+	_, ok = NewMemory(0, nil).Grow(MaxMemoryPages + 1)
+	assert.False(t, ok)
+}
+
+func TestNewVM_sharedMemory(t *testing.T) {
+	shared := NewMemory(1, nil)
+	externModules := map[string]*Module{
+		"env": {
+			SecExports: map[string]*ExportSegment{
+				"memory": {Name: "memory", Desc: &ExportDesc{Kind: ExportKindMem}},
+			},
+			IndexSpace: &ModuleIndexSpace{Memory: []*Memory{shared}},
+		},
+	}
+
+	newImporter := func() *VirtualMachine {
+		m := &Module{
+			SecTypes: []*FunctionType{
+				{InputTypes: []ValueType{ValueTypeI32}, ReturnTypes: []ValueType{ValueTypeI32}},
+				{ReturnTypes: []ValueType{ValueTypeI32}},
+			},
+			SecImports: []*ImportSegment{{Module: "env", Name: "memory", Desc: &ImportDesc{
+				Kind: ExportKindMem, MemTypePtr: &MemoryType{Min: 1},
+			}}},
+			SecFunctions: []uint32{0, 1, 1},
+			SecCodes: []*CodeSegment{
+				{Body: []byte{byte(OptCodeLocalGet), 0x00, byte(OptCodeMemoryGrow), 0x00}},
+				{Body: []byte{byte(OptCodeMemorySize), 0x00}},
+				// load the last i32 of the memory
+				{Body: []byte{
+					byte(OptCodeMemorySize), 0x00, byte(OptCodeI32Const), 0x80, 0x80, 0x04, byte(OptCodeI32mul),
+					byte(OptCodeI32Const), 0x04, byte(OptCodeI32sub),
+					byte(OptCodeI32Load), 0x02, 0x00,
+				}},
+			},
+			SecData: []*DataSegment{{
+				OffsetExpression: &ConstantExpression{data: []byte{byte(OptCodeI32Const), 0x00}},
+				Init:             []byte{0x01},
+			}},
+			SecExports: map[string]*ExportSegment{
+				"grow": {Name: "grow", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 0}},
+				"size": {Name: "size", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 1}},
+				"last": {Name: "last", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 2}},
+			},
+		}
+		vm, err := NewVM(m, externModules)
+		require.NoError(t, err)
+		return vm
+	}
+
+	vm1, vm2 := newImporter(), newImporter()
+	require.Same(t, shared, vm1.Memory)
+	require.Same(t, shared, vm2.Memory)
+	require.Equal(t, byte(0x01), shared.Bytes()[0])
+
+	ret, _, err := vm1.ExecExportedFunction("grow", 2)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), ret[0])
+	require.Equal(t, uint32(3), shared.Size())
+
+	ret, _, err = vm2.ExecExportedFunction("size")
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), ret[0])
+
+	// the host writes into the grown region and the importers read it
+	b := shared.Bytes()
+	copy(b[len(b)-4:], []byte{0xff, 0x00, 0x00, 0x00})
+	for _, vm := range []*VirtualMachine{vm1, vm2} {
+		ret, _, err = vm.ExecExportedFunction("last")
+		require.NoError(t, err)
+		require.Equal(t, uint64(0xff), ret[0])
+	}
+
+	// the host grows the memory
+	_, ok := shared.Grow(1)
+	require.True(t, ok)
+	ret, _, err = vm1.ExecExportedFunction("size")
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), ret[0])
+}
+
+func TestMemory_ReadWrite(t *testing.T) {
+	m := NewMemory(1, nil)
+	last := uint32(vmPageSize)
+
+	require.True(t, m.WriteUint32Le(0, 0xdeadbeef))
+	v32, ok := m.ReadUint32Le(0)
+	require.True(t, ok)
+	assert.Equal(t, uint32(0xdeadbeef), v32)
+
+	require.True(t, m.WriteUint64Le(last-8, math.MaxUint64))
+	v64, ok := m.ReadUint64Le(last - 8)
+	require.True(t, ok)
+	assert.Equal(t, uint64(math.MaxUint64), v64)
+
+	require.True(t, m.WriteFloat32Le(8, 1.5))
+	f32, ok := m.ReadFloat32Le(8)
+	require.True(t, ok)
+	assert.Equal(t, float32(1.5), f32)
+
+	require.True(t, m.WriteFloat64Le(16, -2.5))
+	f64, ok := m.ReadFloat64Le(16)
+	require.True(t, ok)
+	assert.Equal(t, -2.5, f64)
+
+	require.True(t, m.Write(32, []byte("hello\x00")))
+	str, ok := m.ReadString(32, 5)
+	require.True(t, ok)
+	assert.Equal(t, "hello", str)
+	str, ok = m.ReadCString(32)
+	require.True(t, ok)
+	assert.Equal(t, "hello", str)
+
+	b, ok := m.Read(32, 2)
+	require.True(t, ok)
+	b[0] = 'j'
+	str, _ = m.ReadString(32, 5)
+	assert.Equal(t, "jello", str)
+
+	// out of bounds accesses never panic
+	for _, ok := range []bool{
+		m.WriteUint32Le(last-3, 0),
+		m.WriteUint64Le(last-7, 0),
+		m.WriteFloat32Le(math.MaxUint32, 0),
+		m.WriteFloat64Le(last, 0),
+		m.Write(last-1, []byte{0, 0}),
+	} {
+		assert.False(t, ok)
+	}
+	_, ok = m.ReadUint32Le(math.MaxUint32)
+	assert.False(t, ok)
+	_, ok = m.ReadUint64Le(last - 7)
+	assert.False(t, ok)
+	_, ok = m.Read(1, math.MaxUint32)
+	assert.False(t, ok)
+	_, ok = m.ReadString(last, 1)
+	assert.False(t, ok)
+	_, ok = m.ReadCString(last + 1)
+	assert.False(t, ok)
+
+	// unterminated
+	require.True(t, m.Write(last-1, []byte{'a'}))
+	_, ok = m.ReadCString(last - 1)
+	assert.False(t, ok)
+
+	// the virtual machine may have no memory
+	var nilMem *Memory
+	_, ok = nilMem.Read(0, 0)
+	assert.False(t, ok)
+}
+
+func TestMemory_Read_maxPages(t *testing.T) {
+	if testing.Short() || strconv.IntSize == 32 {
+		t.Skip("allocates 4GiB")
+	}
+	// the end of the range is 2^32, which overflows uint32
+	m := NewMemory(MaxMemoryPages, nil)
+	b, ok := m.Read(math.MaxUint32-3, 4)
+	require.True(t, ok)
+	assert.Len(t, b, 4)
+	str, ok := m.ReadString(math.MaxUint32, 1)
+	require.True(t, ok)
+	assert.Equal(t, "\x00", str)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/mathetake/gasm/wasm/leb128"
 )
@@ -37,14 +38,17 @@ type (
 	ModuleIndexSpace struct {
 		Function []VirtualMachineFunction
 		Globals  []*Global
-		Table    [][]*uint32
-		Memory   [][]byte
+		Table    []*Table
+		Memory   []*Memory
 	}
 
-	// initialized global
+	// Global is an initialized global. It is shared by reference between
+	// the exporting and importing modules so that writes to a mutable global
+	// are observed by all of them.
 	Global struct {
 		Type *GlobalType
-		Val  interface{}
+		// Val is the raw representation of the value as it is on the operand stack
+		Val uint64
 	}
 )
 
@@ -79,37 +83,33 @@ func DecodeModule(r io.Reader) (*Module, error) {
 	return ret, nil
 }
 
-// buildIndexSpaces build index spaces of the module with the given external modules
-func (m *Module) buildIndexSpaces(externModules map[string]*Module) error {
+// buildIndexSpaces build index spaces of the module whose imports are resolved by the given resolver
+func (m *Module) buildIndexSpaces(resolver ImportResolver) error {
 	m.IndexSpace = new(ModuleIndexSpace)
 
 	// resolve imports
-	if err := m.resolveImports(externModules); err != nil {
+	if err := m.resolveImports(resolver); err != nil {
 		return fmt.Errorf("resolve imports: %w", err)
 	}
 
 	// fill in the gap between the definition and imported ones in index spaces
-	// note: MVP restricts the size of memory index spaces to 1
-	if diff := len(m.SecTables) - len(m.IndexSpace.Table); diff > 0 {
-		for i := 0; i < diff; i++ {
-			m.IndexSpace.Table = append(m.IndexSpace.Table, []*uint32{})
-		}
+	// note: MVP restricts the size of table index spaces to 1
+	for _, tt := range m.SecTables {
+		m.IndexSpace.Table = append(m.IndexSpace.Table, NewTable(tt.Limit.Min, tt.Limit.Max))
 	}
 
-	// fill in the gap between the definition and imported ones in index spaces
 	// note: MVP restricts the size of memory index spaces to 1
-	if diff := len(m.SecMemory) - len(m.IndexSpace.Memory); diff > 0 {
-		for i := 0; i < diff; i++ {
-			m.IndexSpace.Memory = append(m.IndexSpace.Memory, []byte{})
-		}
+	for _, mt := range m.SecMemory {
+		m.IndexSpace.Memory = append(m.IndexSpace.Memory, NewMemory(mt.Min, mt.Max))
 	}
 
-	if err := m.buildGlobalIndexSpace(); err != nil {
-		return fmt.Errorf("build global index space: %w", err)
-	}
+	// functions are built first so that ref.func in global initializers can be validated
 	if err := m.buildFunctionIndexSpace(); err != nil {
 		return fmt.Errorf("build function index space: %w", err)
 	}
+	if err := m.buildGlobalIndexSpace(); err != nil {
+		return fmt.Errorf("build global index space: %w", err)
+	}
 	if err := m.buildTableIndexSpace(); err != nil {
 		return fmt.Errorf("build table index space: %w", err)
 	}
@@ -119,104 +119,160 @@ func (m *Module) buildIndexSpaces(externModules map[string]*Module) error {
 	return nil
 }
 
-func (m *Module) resolveImports(externModules map[string]*Module) error {
+func (m *Module) resolveImports(resolver ImportResolver) error {
+	// collect all the imports not found so that they can be reported at once
+	var missing []string
 	for _, is := range m.SecImports {
-		if err := m.resolveImport(is, externModules); err != nil {
+		err := m.resolveImport(is, resolver)
+		if errors.Is(err, ErrImportNotFound) {
+			missing = append(missing, is.Module+"."+is.Name)
+		} else if err != nil {
 			return fmt.Errorf("%s: %w", is.Name, err)
 		}
 	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrImportNotFound, strings.Join(missing, ", "))
+	}
 	return nil
 }
 
-func (m *Module) resolveImport(is *ImportSegment, externModules map[string]*Module) error {
-	em, ok := externModules[is.Module]
-	if !ok {
-		return fmt.Errorf("failed to resolve import of module name %s", is.Module)
+func (m *Module) resolveImport(is *ImportSegment, resolver ImportResolver) error {
+	desc, err := m.importDescriptor(is)
+	if err != nil {
+		return err
 	}
 
-	es, ok := em.SecExports[is.Name]
-	if !ok {
-		return fmt.Errorf("not exported in module %s", is.Module)
+	ext, err := resolver.ResolveImport(desc)
+	if err != nil {
+		return err
+	} else if ext == nil {
+		return fmt.Errorf("failed to resolve import of %s.%s", is.Module, is.Name)
 	}
 
-	if is.Desc.Kind != es.Desc.Kind {
-		return fmt.Errorf("type mismatch on export: got %#x but want %#x", es.Desc.Kind, is.Desc.Kind)
-	}
-	switch is.Desc.Kind {
-	case 0x00: // function
-		if err := m.applyFunctionImport(is, em, es); err != nil {
+	switch desc.Kind {
+	case ExportKindFunction:
+		if err := m.applyFunctionImport(desc, ext.Function); err != nil {
 			return fmt.Errorf("applyFunctionImport failed: %w", err)
 		}
-	case 0x01: // table
-		if err := m.applyTableImport(em, es); err != nil {
+	case ExportKindTable:
+		if err := m.applyTableImport(desc, ext.Table); err != nil {
 			return fmt.Errorf("applyTableImport failed: %w", err)
 		}
-	case 0x02: // mem
-		if err := m.applyMemoryImport(em, es); err != nil {
+	case ExportKindMem:
+		if err := m.applyMemoryImport(desc, ext.Memory); err != nil {
 			return fmt.Errorf("applyMemoryImport: %w", err)
 		}
-	case 0x03: // global
-		if err := m.applyGlobalImport(em, es); err != nil {
+	case ExportKindGlobal:
+		if err := m.applyGlobalImport(desc, ext.Global); err != nil {
 			return fmt.Errorf("applyGlobalImport: %w", err)
 		}
-	default:
-		return fmt.Errorf("invalid kind of import: %#x", is.Desc.Kind)
 	}
-
 	return nil
 }
 
-func (m *Module) applyFunctionImport(is *ImportSegment, em *Module, es *ExportSegment) error {
-	if es.Desc.Index >= uint32(len(em.IndexSpace.Function)) {
-		return fmt.Errorf("exported index out of range")
+// importDescriptor returns the descriptor of the import with its type resolved.
+func (m *Module) importDescriptor(is *ImportSegment) (*ImportDescriptor, error) {
+	if is.Desc == nil {
+		return nil, fmt.Errorf("is.Desc is nil")
+	}
+
+	desc := &ImportDescriptor{Module: is.Module, Name: is.Name, Kind: is.Desc.Kind}
+	switch is.Desc.Kind {
+	case ExportKindFunction:
+		if is.Desc.TypeIndexPtr == nil {
+			return nil, fmt.Errorf("is.Desc.TypeIndexPtr is nil")
+		} else if idx := *is.Desc.TypeIndexPtr; idx >= uint32(len(m.SecTypes)) {
+			return nil, fmt.Errorf("type index out of range")
+		}
+		desc.FunctionType = m.SecTypes[*is.Desc.TypeIndexPtr]
+	case ExportKindTable:
+		if is.Desc.TableTypePtr == nil || is.Desc.TableTypePtr.Limit == nil {
+			return nil, fmt.Errorf("is.Desc.TableTypePtr is nil")
+		}
+		desc.Table = is.Desc.TableTypePtr
+	case ExportKindMem:
+		if is.Desc.MemTypePtr == nil {
+			return nil, fmt.Errorf("is.Desc.MemTypePtr is nil")
+		}
+		desc.Memory = is.Desc.MemTypePtr
+	case ExportKindGlobal:
+		if is.Desc.GlobalTypePtr == nil {
+			return nil, fmt.Errorf("is.Desc.GlobalTypePtr is nil")
+		}
+		desc.Global = is.Desc.GlobalTypePtr
+	default:
+		return nil, fmt.Errorf("invalid kind of import: %#x", is.Desc.Kind)
 	}
+	return desc, nil
+}
 
-	if is.Desc.TypeIndexPtr == nil {
-		return fmt.Errorf("is.Desc.TypeIndexPtr is nill")
+func (m *Module) applyFunctionImport(desc *ImportDescriptor, f VirtualMachineFunction) error {
+	if f == nil {
+		return fmt.Errorf("function is not provided")
 	}
 
-	iSig := m.SecTypes[*is.Desc.TypeIndexPtr]
-	f := em.IndexSpace.Function[es.Desc.Index]
+	iSig := desc.FunctionType
 	if !hasSameSignature(iSig.ReturnTypes, f.FunctionType().ReturnTypes) {
 		return fmt.Errorf("return signature mimatch: %#x != %#x", iSig.ReturnTypes, f.FunctionType().ReturnTypes)
 	} else if !hasSameSignature(iSig.InputTypes, f.FunctionType().InputTypes) {
 		return fmt.Errorf("input signature mimatch: %#x != %#x", iSig.InputTypes, f.FunctionType().InputTypes)
 	}
+
+	if hf, ok := f.(*HostFunction); ok {
+		// host functions are bound to the importing virtual machine at instantiation,
+		// so each importer needs its own copy
+		f = &HostFunction{ClosureGenerator: hf.ClosureGenerator, Signature: hf.Signature}
+	}
 	m.IndexSpace.Function = append(m.IndexSpace.Function, f)
 	return nil
 }
 
-func (m *Module) applyTableImport(em *Module, es *ExportSegment) error {
-	if es.Desc.Index >= uint32(len(em.IndexSpace.Table)) {
-		return fmt.Errorf("exported index out of range")
+func (m *Module) applyTableImport(desc *ImportDescriptor, table *Table) error {
+	if table == nil {
+		return fmt.Errorf("table is not provided")
+	}
+
+	limit := desc.Table.Limit
+	if size := uint32(len(table.Elements)); size < limit.Min {
+		return fmt.Errorf("table size %d is less than the minimum %d", size, limit.Min)
+	} else if limit.Max != nil && (table.Max == nil || *table.Max > *limit.Max) {
+		return fmt.Errorf("table maximum exceeds the limit of %d", *limit.Max)
 	}
 
 	// note: MVP restricts the size of table index spaces to 1
-	m.IndexSpace.Table = append(m.IndexSpace.Table, em.IndexSpace.Table[es.Desc.Index])
+	m.IndexSpace.Table = append(m.IndexSpace.Table, table)
 	return nil
 }
 
-func (m *Module) applyMemoryImport(em *Module, es *ExportSegment) error {
-	if es.Desc.Index >= uint32(len(em.IndexSpace.Memory)) {
-		return fmt.Errorf("exported index out of range")
+func (m *Module) applyMemoryImport(desc *ImportDescriptor, mem *Memory) error {
+	if mem == nil {
+		return fmt.Errorf("memory is not provided")
+	}
+
+	if mem.Size() < desc.Memory.Min {
+		return fmt.Errorf("memory size %d is less than the minimum %d", mem.Size(), desc.Memory.Min)
+	} else if max := desc.Memory.Max; max != nil && (mem.Max == nil || *mem.Max > *max) {
+		return fmt.Errorf("memory maximum exceeds the limit of %d", *max)
 	}
 
 	// note: MVP restricts the size of memory index spaces to 1
-	m.IndexSpace.Memory = append(m.IndexSpace.Memory, em.IndexSpace.Memory[es.Desc.Index])
+	m.IndexSpace.Memory = append(m.IndexSpace.Memory, mem)
 	return nil
 }
 
-func (m *Module) applyGlobalImport(em *Module, es *ExportSegment) error {
-	if es.Desc.Index >= uint32(len(em.IndexSpace.Globals)) {
-		return fmt.Errorf("exported index out of range")
+func (m *Module) applyGlobalImport(desc *ImportDescriptor, gb *Global) error {
+	if gb == nil {
+		return fmt.Errorf("global is not provided")
 	}
 
-	gb := em.IndexSpace.Globals[es.Desc.Index]
-	if gb.Type.Mutable {
-		return fmt.Errorf("cannot import mutable global")
+	if gb.Type.Value != desc.Global.Value {
+		return fmt.Errorf("value type mismatch: %#x != %#x", gb.Type.Value, desc.Global.Value)
+	} else if gb.Type.Mutable != desc.Global.Mutable {
+		return fmt.Errorf("mutability mismatch: %t != %t", gb.Type.Mutable, desc.Global.Mutable)
 	}
 
-	m.IndexSpace.Globals = append(em.IndexSpace.Globals, gb)
+	m.IndexSpace.Globals = append(m.IndexSpace.Globals, gb)
 	return nil
 }
 
@@ -226,9 +282,17 @@ func (m *Module) buildGlobalIndexSpace() error {
 		if err != nil {
 			return fmt.Errorf("execution failed: %w", err)
 		}
+
+		vt, err := constValueType(v)
+		if err != nil {
+			return err
+		} else if vt != gs.Type.Value {
+			return fmt.Errorf("type mismatch on global initializer: %#x != %#x", vt, gs.Type.Value)
+		}
+
 		m.IndexSpace.Globals = append(m.IndexSpace.Globals, &Global{
 			Type: gs.Type,
-			Val:  v,
+			Val:  rawConstValue(v),
 		})
 	}
 	return nil
@@ -263,8 +327,6 @@ func (m *Module) buildMemoryIndexSpace() error {
 		// note: MVP restricts the size of memory index spaces to 1
 		if d.MemoryIndex >= uint32(len(m.IndexSpace.Memory)) {
 			return fmt.Errorf("index out of range of index space")
-		} else if d.MemoryIndex >= uint32(len(m.SecMemory)) {
-			return fmt.Errorf("index out of range of memory section")
 		}
 
 		rawOffset, err := m.executeConstExpression(d.OffsetExpression)
@@ -272,37 +334,28 @@ func (m *Module) buildMemoryIndexSpace() error {
 			return fmt.Errorf("calculate offset: %w", err)
 		}
 
-		offset, ok := rawOffset.(int32)
+		rawOffset32, ok := rawOffset.(int32)
 		if !ok {
 			return fmt.Errorf("type assertion failed")
 		}
-
-		size := int(offset) + len(d.Init)
-		if m.SecMemory[d.MemoryIndex].Max != nil && uint32(size) > *(m.SecMemory[d.MemoryIndex].Max)*vmPageSize {
-			return fmt.Errorf("memory size out of limit %d * 64Ki", int(*(m.SecMemory[d.MemoryIndex].Max)))
-		}
+		// the offset is an unsigned address, e.g. __memory_base + N may be 2^31 or above
+		offset := uint32(rawOffset32)
 
 		memory := m.IndexSpace.Memory[d.MemoryIndex]
-		if size > len(memory) {
-			next := make([]byte, size)
-			copy(next, memory)
-			copy(next[offset:], d.Init)
-			m.IndexSpace.Memory[d.MemoryIndex] = next
-		} else {
-			copy(memory[offset:], d.Init)
+		if uint64(offset)+uint64(len(d.Init)) > uint64(len(memory.Buffer)) {
+			return fmt.Errorf("out of bounds data segment: offset %d and length %d exceed the memory size %d",
+				offset, len(d.Init), len(memory.Buffer))
 		}
+		copy(memory.Buffer[offset:], d.Init)
 	}
 	return nil
 }
 
 func (m *Module) buildTableIndexSpace() error {
 	for _, elem := range m.SecElements {
-		// note: MVP restricts the size of memory index spaces to 1
+		// note: MVP restricts the size of table index spaces to 1
 		if elem.TableIndex >= uint32(len(m.IndexSpace.Table)) {
 			return fmt.Errorf("index out of range of index space")
-		} else if elem.TableIndex >= uint32(len(m.SecTables)) {
-			// this is just in case since we could assume len(SecTables) == len(IndexSpace.Table)
-			return fmt.Errorf("index out of range of table section")
 		}
 
 		rawOffset, err := m.executeConstExpression(elem.OffsetExpr)
@@ -310,30 +363,24 @@ func (m *Module) buildTableIndexSpace() error {
 			return fmt.Errorf("calculate offset: %w", err)
 		}
 
-		offset32, ok := rawOffset.(int32)
+		rawOffset32, ok := rawOffset.(int32)
 		if !ok {
 			return fmt.Errorf("type assertion failed")
 		}
+		// the offset is unsigned as for data segments
+		offset := uint32(rawOffset32)
 
-		offset := int(offset32)
-		size := offset + len(elem.Init)
-		if m.SecTables[elem.TableIndex].Limit.Max != nil &&
-			size > int(*(m.SecTables[elem.TableIndex].Limit.Max)) {
-			return fmt.Errorf("table size out of limit of %d", int(*(m.SecTables[elem.TableIndex].Limit.Max)))
+		table := m.IndexSpace.Table[elem.TableIndex]
+		if uint64(offset)+uint64(len(elem.Init)) > uint64(len(table.Elements)) {
+			return fmt.Errorf("out of bounds table segment: offset %d and length %d exceed the table size %d",
+				offset, len(elem.Init), len(table.Elements))
 		}
 
-		table := m.IndexSpace.Table[elem.TableIndex]
-		if size > len(table) {
-			next := make([]*uint32, size)
-			copy(next, table)
-			for i := range elem.Init {
-				next[i+offset] = &elem.Init[i]
-			}
-			m.IndexSpace.Table[elem.TableIndex] = next
-		} else {
-			for i := range elem.Init {
-				table[i+offset] = &elem.Init[i]
+		for i, fIdx := range elem.Init {
+			if fIdx >= uint32(len(m.IndexSpace.Function)) {
+				return fmt.Errorf("function index out of range")
 			}
+			table.Elements[uint64(offset)+uint64(i)] = m.IndexSpace.Function[fIdx]
 		}
 	}
 	return nil
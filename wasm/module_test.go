@@ -2,6 +2,7 @@ package wasm
 
 import (
 	"bytes"
+	"errors"
 	"strconv"
 	"testing"
 
@@ -22,7 +23,7 @@ func TestModule_resolveImports(t *testing.T) {
 			},
 			{
 				module: &Module{SecImports: []*ImportSegment{
-					{Module: "a", Name: "b"},
+					{Module: "a", Name: "b", Desc: &ImportDesc{Kind: 0x03, GlobalTypePtr: &GlobalType{}}},
 				}},
 				externModules: map[string]*Module{
 					"a": {},
@@ -30,7 +31,7 @@ func TestModule_resolveImports(t *testing.T) {
 			},
 			{
 				module: &Module{SecImports: []*ImportSegment{
-					{Module: "a", Name: "b", Desc: &ImportDesc{}},
+					{Module: "a", Name: "b", Desc: &ImportDesc{Kind: 0x03, GlobalTypePtr: &GlobalType{}}},
 				}},
 				externModules: map[string]*Module{
 					"a": {SecExports: map[string]*ExportSegment{
@@ -38,20 +39,46 @@ func TestModule_resolveImports(t *testing.T) {
 							Name: "a",
 							Desc: &ExportDesc{Kind: 1},
 						},
-					}},
+					}, IndexSpace: new(ModuleIndexSpace)},
 				},
 			},
+			{
+				module: &Module{SecImports: []*ImportSegment{
+					{Module: "a", Name: "b", Desc: &ImportDesc{Kind: 0x00, TypeIndexPtr: uint32Ptr(0)}},
+				}},
+			},
 		} {
-			err := c.module.resolveImports(c.externModules)
+			err := c.module.resolveImports(ModuleResolver(c.externModules))
 			assert.Error(t, err)
 			t.Log(err)
 		}
 	})
 
+	t.Run("not found", func(t *testing.T) {
+		m := &Module{
+			SecImports: []*ImportSegment{
+				{Module: "a", Name: "b", Desc: &ImportDesc{Kind: 0x03, GlobalTypePtr: &GlobalType{}}},
+				{Module: "a", Name: "c", Desc: &ImportDesc{Kind: 0x03, GlobalTypePtr: &GlobalType{}}},
+				{Module: "d", Name: "e", Desc: &ImportDesc{Kind: 0x02, MemTypePtr: &MemoryType{}}},
+			},
+			IndexSpace: new(ModuleIndexSpace),
+		}
+		ems := map[string]*Module{
+			"a": {
+				SecExports: map[string]*ExportSegment{"c": {Name: "c", Desc: &ExportDesc{Kind: 0x03}}},
+				IndexSpace: &ModuleIndexSpace{Globals: []*Global{{Type: &GlobalType{}}}},
+			},
+		}
+
+		err := m.resolveImports(ModuleResolver(ems))
+		require.True(t, errors.Is(err, ErrImportNotFound))
+		assert.Contains(t, err.Error(), "a.b, d.e")
+	})
+
 	t.Run("ok", func(t *testing.T) {
 		m := &Module{
 			SecImports: []*ImportSegment{
-				{Module: "a", Name: "b", Desc: &ImportDesc{Kind: 0x03}},
+				{Module: "a", Name: "b", Desc: &ImportDesc{Kind: 0x03, GlobalTypePtr: &GlobalType{}}},
 			},
 			IndexSpace: new(ModuleIndexSpace),
 		}
@@ -72,166 +99,183 @@ func TestModule_resolveImports(t *testing.T) {
 			},
 		}
 
-		err := m.resolveImports(ems)
+		err := m.resolveImports(ModuleResolver(ems))
 		require.NoError(t, err)
-		assert.Equal(t, 1, m.IndexSpace.Globals[0].Val)
+		assert.Equal(t, uint64(1), m.IndexSpace.Globals[0].Val)
 	})
 }
 
-func TestModule_applyFunctionImport(t *testing.T) {
+func TestModule_importDescriptor(t *testing.T) {
+	m := &Module{SecTypes: []*FunctionType{{InputTypes: []ValueType{ValueTypeI32}}}}
 	t.Run("ok", func(t *testing.T) {
-		m := Module{
-			SecTypes:   []*FunctionType{{ReturnTypes: []ValueType{ValueTypeF64}}},
-			IndexSpace: new(ModuleIndexSpace),
+		mt := &MemoryType{Min: 1}
+		actual, err := m.importDescriptor(&ImportSegment{
+			Module: "a", Name: "b", Desc: &ImportDesc{Kind: ExportKindMem, MemTypePtr: mt},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, &ImportDescriptor{Module: "a", Name: "b", Kind: ExportKindMem, Memory: mt}, actual)
+
+		actual, err = m.importDescriptor(&ImportSegment{
+			Module: "a", Name: "c", Desc: &ImportDesc{Kind: ExportKindFunction, TypeIndexPtr: uint32Ptr(0)},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, m.SecTypes[0], actual.FunctionType)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		for _, desc := range []*ImportDesc{
+			nil,
+			{Kind: ExportKindFunction},
+			{Kind: ExportKindFunction, TypeIndexPtr: uint32Ptr(1)},
+			{Kind: ExportKindTable},
+			{Kind: ExportKindTable, TableTypePtr: &TableType{}},
+			{Kind: ExportKindMem},
+			{Kind: ExportKindGlobal},
+			{Kind: 0x10},
+		} {
+			_, err := m.importDescriptor(&ImportSegment{Desc: desc})
+			assert.Error(t, err)
 		}
-		is := &ImportSegment{Desc: &ImportDesc{TypeIndexPtr: uint32Ptr(0)}}
-		em := &Module{IndexSpace: &ModuleIndexSpace{Function: []VirtualMachineFunction{
-			&NativeFunction{
-				Signature: &FunctionType{ReturnTypes: []ValueType{ValueTypeF64}}},
-		}}}
-		es := &ExportSegment{Desc: &ExportDesc{}}
-		err := m.applyFunctionImport(is, em, es)
+	})
+}
+
+func TestModule_applyFunctionImport(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		m := Module{IndexSpace: new(ModuleIndexSpace)}
+		desc := &ImportDescriptor{FunctionType: &FunctionType{ReturnTypes: []ValueType{ValueTypeF64}}}
+		f := &NativeFunction{Signature: &FunctionType{ReturnTypes: []ValueType{ValueTypeF64}}}
+		err := m.applyFunctionImport(desc, f)
 		require.NoError(t, err)
-		assert.Equal(t, em.IndexSpace.Function[0], m.IndexSpace.Function[0])
+		assert.Equal(t, f, m.IndexSpace.Function[0])
 	})
 
 	t.Run("error", func(t *testing.T) {
 		for _, c := range []struct {
-			module          Module
-			importSegment   *ImportSegment
-			exportedModule  *Module
-			exportedSegment *ExportSegment
+			expected *FunctionType
+			function VirtualMachineFunction
 		}{
+			{expected: &FunctionType{}},
 			{
-				module:          Module{IndexSpace: new(ModuleIndexSpace)},
-				exportedModule:  &Module{IndexSpace: new(ModuleIndexSpace)},
-				exportedSegment: &ExportSegment{Desc: &ExportDesc{Index: 10}},
-			},
-			{
-				module:          Module{IndexSpace: new(ModuleIndexSpace)},
-				exportedModule:  &Module{IndexSpace: new(ModuleIndexSpace)},
-				exportedSegment: &ExportSegment{Desc: &ExportDesc{}},
+				expected: &FunctionType{InputTypes: []ValueType{ValueTypeF64}},
+				function: &NativeFunction{Signature: &FunctionType{}},
 			},
 			{
-				module:          Module{SecTypes: []*FunctionType{{InputTypes: []ValueType{ValueTypeF64}}}},
-				importSegment:   &ImportSegment{Desc: &ImportDesc{TypeIndexPtr: uint32Ptr(0)}},
-				exportedModule:  &Module{IndexSpace: &ModuleIndexSpace{Function: []VirtualMachineFunction{&NativeFunction{Signature: &FunctionType{}}}}},
-				exportedSegment: &ExportSegment{Desc: &ExportDesc{}},
+				expected: &FunctionType{ReturnTypes: []ValueType{ValueTypeF64}},
+				function: &NativeFunction{Signature: &FunctionType{}},
 			},
 			{
-				module:          Module{SecTypes: []*FunctionType{{ReturnTypes: []ValueType{ValueTypeF64}}}},
-				importSegment:   &ImportSegment{Desc: &ImportDesc{TypeIndexPtr: uint32Ptr(0)}},
-				exportedModule:  &Module{IndexSpace: &ModuleIndexSpace{Function: []VirtualMachineFunction{&NativeFunction{Signature: &FunctionType{}}}}},
-				exportedSegment: &ExportSegment{Desc: &ExportDesc{}},
+				expected: &FunctionType{},
+				function: &NativeFunction{Signature: &FunctionType{InputTypes: []ValueType{ValueTypeF64}}},
 			},
 			{
-				module:        Module{SecTypes: []*FunctionType{{}}},
-				importSegment: &ImportSegment{Desc: &ImportDesc{TypeIndexPtr: uint32Ptr(0)}},
-				exportedModule: &Module{IndexSpace: &ModuleIndexSpace{Function: []VirtualMachineFunction{&NativeFunction{
-					Signature: &FunctionType{InputTypes: []ValueType{ValueTypeF64}}}},
-				}},
-				exportedSegment: &ExportSegment{Desc: &ExportDesc{}},
-			},
-			{
-				module:        Module{SecTypes: []*FunctionType{{}}},
-				importSegment: &ImportSegment{Desc: &ImportDesc{TypeIndexPtr: uint32Ptr(0)}},
-				exportedModule: &Module{IndexSpace: &ModuleIndexSpace{Function: []VirtualMachineFunction{&NativeFunction{
-					Signature: &FunctionType{ReturnTypes: []ValueType{ValueTypeF64}}}},
-				}},
-				exportedSegment: &ExportSegment{Desc: &ExportDesc{}},
+				expected: &FunctionType{},
+				function: &NativeFunction{Signature: &FunctionType{ReturnTypes: []ValueType{ValueTypeF64}}},
 			},
 		} {
-			assert.Error(t, (&c.module).applyFunctionImport(c.importSegment, c.exportedModule, c.exportedSegment))
+			m := Module{IndexSpace: new(ModuleIndexSpace)}
+			assert.Error(t, m.applyFunctionImport(&ImportDescriptor{FunctionType: c.expected}, c.function))
 		}
 	})
 }
 
 func TestModule_applyTableImport(t *testing.T) {
 	t.Run("error", func(t *testing.T) {
-		es := &ExportSegment{Desc: &ExportDesc{Index: 10}}
-		em := &Module{IndexSpace: new(ModuleIndexSpace)}
-		err := (&Module{}).applyTableImport(em, es)
-		assert.Error(t, err)
+		for _, c := range []struct {
+			expected *TableType
+			table    *Table
+		}{
+			{expected: &TableType{Limit: &LimitsType{}}},
+			{expected: &TableType{Limit: &LimitsType{Min: 2}}, table: NewTable(1, nil)},
+			{expected: &TableType{Limit: &LimitsType{Max: uint32Ptr(2)}}, table: NewTable(1, nil)},
+			{expected: &TableType{Limit: &LimitsType{Max: uint32Ptr(2)}}, table: NewTable(1, uint32Ptr(3))},
+		} {
+			err := (&Module{}).applyTableImport(&ImportDescriptor{Table: c.expected}, c.table)
+			assert.Error(t, err)
+			t.Log(err)
+		}
 	})
 
 	t.Run("ok", func(t *testing.T) {
-		es := &ExportSegment{Desc: &ExportDesc{}}
-
-		var exp uint32 = 10
-		em := &Module{
-			IndexSpace: &ModuleIndexSpace{Table: [][]*uint32{{&exp}}},
-		}
+		desc := &ImportDescriptor{Table: &TableType{Limit: &LimitsType{Min: 1}}}
+		exp := &Table{Elements: []VirtualMachineFunction{&NativeFunction{}}}
 		m := &Module{IndexSpace: new(ModuleIndexSpace)}
-		err := m.applyTableImport(em, es)
+		err := m.applyTableImport(desc, exp)
 		require.NoError(t, err)
-		assert.Equal(t, exp, *m.IndexSpace.Table[0][0])
+		assert.Same(t, exp, m.IndexSpace.Table[0])
 	})
 }
 
 func TestModule_applyMemoryImport(t *testing.T) {
 	t.Run("error", func(t *testing.T) {
-		es := &ExportSegment{Desc: &ExportDesc{Index: 10}}
-		em := &Module{IndexSpace: new(ModuleIndexSpace)}
-		err := (&Module{}).applyMemoryImport(em, es)
-		assert.Error(t, err)
+		for _, c := range []struct {
+			expected *MemoryType
+			memory   *Memory
+		}{
+			{expected: &MemoryType{}},
+			{expected: &MemoryType{Min: 2}, memory: NewMemory(1, nil)},
+			{expected: &MemoryType{Max: uint32Ptr(2)}, memory: NewMemory(1, nil)},
+		} {
+			err := (&Module{}).applyMemoryImport(&ImportDescriptor{Memory: c.expected}, c.memory)
+			assert.Error(t, err)
+			t.Log(err)
+		}
 	})
 
 	t.Run("ok", func(t *testing.T) {
-		es := &ExportSegment{Desc: &ExportDesc{}}
-		em := &Module{
-			IndexSpace: &ModuleIndexSpace{Memory: [][]byte{{0x01}}},
-		}
+		desc := &ImportDescriptor{Memory: &MemoryType{Min: 1, Max: uint32Ptr(2)}}
+		exp := NewMemory(1, uint32Ptr(2))
 		m := &Module{IndexSpace: new(ModuleIndexSpace)}
-		err := m.applyMemoryImport(em, es)
+		err := m.applyMemoryImport(desc, exp)
 		require.NoError(t, err)
-		assert.Equal(t, byte(0x01), m.IndexSpace.Memory[0][0])
+		assert.Same(t, exp, m.IndexSpace.Memory[0])
 	})
 }
 
 func TestModule_applyGlobalImport(t *testing.T) {
 	t.Run("error", func(t *testing.T) {
 		for _, c := range []struct {
-			exportedModule  *Module
-			exportedSegment *ExportSegment
+			expected *GlobalType
+			global   *Global
 		}{
-			{
-				exportedModule:  &Module{IndexSpace: new(ModuleIndexSpace)},
-				exportedSegment: &ExportSegment{Desc: &ExportDesc{Index: 10}},
-			},
-			{
-				exportedModule: &Module{IndexSpace: &ModuleIndexSpace{Globals: []*Global{{Type: &GlobalType{
-					Mutable: true,
-				}}}}},
-				exportedSegment: &ExportSegment{Desc: &ExportDesc{}},
-			},
+			{expected: &GlobalType{}},
+			{expected: &GlobalType{}, global: &Global{Type: &GlobalType{Mutable: true}}},
+			{expected: &GlobalType{Value: ValueTypeI64}, global: &Global{Type: &GlobalType{Value: ValueTypeI32}}},
 		} {
 			m := Module{}
-			assert.Error(t, m.applyGlobalImport(c.exportedModule, c.exportedSegment))
+			assert.Error(t, m.applyGlobalImport(&ImportDescriptor{Global: c.expected}, c.global))
 		}
 	})
 
 	t.Run("ok", func(t *testing.T) {
-		m := Module{IndexSpace: new(ModuleIndexSpace)}
-		em := &Module{
-			IndexSpace: &ModuleIndexSpace{
-				Globals: []*Global{{Type: &GlobalType{}, Val: 1}},
-			},
-		}
-		es := &ExportSegment{Desc: &ExportDesc{}}
+		for _, mutable := range []bool{false, true} {
+			m := Module{IndexSpace: new(ModuleIndexSpace)}
+			exp := &Global{Type: &GlobalType{Value: ValueTypeI32, Mutable: mutable}, Val: 1}
+			desc := &ImportDescriptor{Global: &GlobalType{Value: ValueTypeI32, Mutable: mutable}}
 
-		err := m.applyGlobalImport(em, es)
-		require.NoError(t, err)
-		assert.Equal(t, 1, m.IndexSpace.Globals[0].Val)
+			err := m.applyGlobalImport(desc, exp)
+			require.NoError(t, err)
+			// the imported global must be the same cell as the exported one
+			assert.Same(t, exp, m.IndexSpace.Globals[0])
+		}
 	})
 }
 
 func TestModule_buildGlobalIndexSpace(t *testing.T) {
-	m := &Module{SecGlobals: []*GlobalSegment{{Type: nil, Init: &ConstantExpression{
-		optCode: OptCodeI64Const,
-		data:    []byte{0x01},
-	}}}, IndexSpace: new(ModuleIndexSpace)}
-	require.NoError(t, m.buildGlobalIndexSpace())
-	assert.Equal(t, &Global{Type: nil, Val: int64(1)}, m.IndexSpace.Globals[0])
+	t.Run("ok", func(t *testing.T) {
+		gt := &GlobalType{Value: ValueTypeI64}
+		m := &Module{SecGlobals: []*GlobalSegment{{Type: gt, Init: &ConstantExpression{
+			data: []byte{byte(OptCodeI64Const), 0x01},
+		}}}, IndexSpace: new(ModuleIndexSpace)}
+		require.NoError(t, m.buildGlobalIndexSpace())
+		assert.Equal(t, &Global{Type: gt, Val: 1}, m.IndexSpace.Globals[0])
+	})
+
+	t.Run("type mismatch", func(t *testing.T) {
+		m := &Module{SecGlobals: []*GlobalSegment{{Type: &GlobalType{Value: ValueTypeI32}, Init: &ConstantExpression{
+			data: []byte{byte(OptCodeI64Const), 0x01},
+		}}}, IndexSpace: new(ModuleIndexSpace)}
+		assert.Error(t, m.buildGlobalIndexSpace())
+	})
 }
 
 func TestModule_buildFunctionIndexSpace(t *testing.T) {
@@ -261,26 +305,49 @@ func TestModule_buildMemoryIndexSpace(t *testing.T) {
 	t.Run("error", func(t *testing.T) {
 		for _, m := range []*Module{
 			{SecData: []*DataSegment{{MemoryIndex: 1}}, IndexSpace: new(ModuleIndexSpace)},
-			{SecData: []*DataSegment{{MemoryIndex: 0}}, IndexSpace: &ModuleIndexSpace{
-				Memory: [][]byte{{}},
-			}},
-
 			{
 				SecData:    []*DataSegment{{OffsetExpression: &ConstantExpression{}}},
 				SecMemory:  []*MemoryType{{}},
-				IndexSpace: &ModuleIndexSpace{Memory: [][]byte{{}}},
+				IndexSpace: &ModuleIndexSpace{Memory: []*Memory{{Buffer: []byte{}}}},
 			},
 			{
 				SecData: []*DataSegment{
 					{
 						OffsetExpression: &ConstantExpression{
-							optCode: OptCodeI32Const, data: []byte{0x01},
+							data: []byte{byte(OptCodeI32Const), 0x01},
 						},
 						Init: []byte{0x01, 0x02},
 					},
 				},
 				SecMemory:  []*MemoryType{{Max: uint32Ptr(0)}},
-				IndexSpace: &ModuleIndexSpace{Memory: [][]byte{{}}},
+				IndexSpace: &ModuleIndexSpace{Memory: []*Memory{{Buffer: []byte{}, Max: uint32Ptr(0)}}},
+			},
+			{
+				// the offset 2^31 computed with extended-const is negative as int32
+				SecData: []*DataSegment{
+					{
+						OffsetExpression: &ConstantExpression{data: []byte{
+							byte(OptCodeI32Const), 0xff, 0xff, 0xff, 0xff, 0x07,
+							byte(OptCodeI32Const), 0x01, byte(OptCodeI32add),
+						}},
+						Init: []byte{0x01},
+					},
+				},
+				SecMemory:  []*MemoryType{{Min: 1}},
+				IndexSpace: &ModuleIndexSpace{Memory: []*Memory{NewMemory(1, nil)}},
+			},
+			{
+				// the segment doesn't fit in the memory, which doesn't grow even without maximum
+				SecData: []*DataSegment{
+					{
+						OffsetExpression: &ConstantExpression{
+							data: []byte{byte(OptCodeI32Const), 0x02},
+						},
+						Init: []byte{0x01, 0x01},
+					},
+				},
+				SecMemory:  []*MemoryType{{}},
+				IndexSpace: &ModuleIndexSpace{Memory: []*Memory{{Buffer: []byte{0x00, 0x00, 0x00}}}},
 			},
 		} {
 			err := m.buildMemoryIndexSpace()
@@ -299,14 +366,13 @@ func TestModule_buildMemoryIndexSpace(t *testing.T) {
 					SecData: []*DataSegment{
 						{
 							OffsetExpression: &ConstantExpression{
-								optCode: OptCodeI32Const,
-								data:    []byte{0x00},
+								data: []byte{byte(OptCodeI32Const), 0x00},
 							},
 							Init: []byte{0x01, 0x01},
 						},
 					},
 					SecMemory:  []*MemoryType{{}},
-					IndexSpace: &ModuleIndexSpace{Memory: [][]byte{{}}},
+					IndexSpace: &ModuleIndexSpace{Memory: []*Memory{{Buffer: []byte{0x00, 0x00}}}},
 				},
 				exp: [][]byte{{0x01, 0x01}},
 			},
@@ -315,14 +381,13 @@ func TestModule_buildMemoryIndexSpace(t *testing.T) {
 					SecData: []*DataSegment{
 						{
 							OffsetExpression: &ConstantExpression{
-								optCode: OptCodeI32Const,
-								data:    []byte{0x00},
+								data: []byte{byte(OptCodeI32Const), 0x00},
 							},
 							Init: []byte{0x01, 0x01},
 						},
 					},
 					SecMemory:  []*MemoryType{{}},
-					IndexSpace: &ModuleIndexSpace{Memory: [][]byte{{0x00, 0x00, 0x00}}},
+					IndexSpace: &ModuleIndexSpace{Memory: []*Memory{{Buffer: []byte{0x00, 0x00, 0x00}}}},
 				},
 				exp: [][]byte{{0x01, 0x01, 0x00}},
 			},
@@ -331,14 +396,13 @@ func TestModule_buildMemoryIndexSpace(t *testing.T) {
 					SecData: []*DataSegment{
 						{
 							OffsetExpression: &ConstantExpression{
-								optCode: OptCodeI32Const,
-								data:    []byte{0x01},
+								data: []byte{byte(OptCodeI32Const), 0x01},
 							},
 							Init: []byte{0x01, 0x01},
 						},
 					},
 					SecMemory:  []*MemoryType{{}},
-					IndexSpace: &ModuleIndexSpace{Memory: [][]byte{{0x00, 0x00, 0x00}}},
+					IndexSpace: &ModuleIndexSpace{Memory: []*Memory{{Buffer: []byte{0x00, 0x00, 0x00}}}},
 				},
 				exp: [][]byte{{0x00, 0x01, 0x01}},
 			},
@@ -347,58 +411,64 @@ func TestModule_buildMemoryIndexSpace(t *testing.T) {
 					SecData: []*DataSegment{
 						{
 							OffsetExpression: &ConstantExpression{
-								optCode: OptCodeI32Const,
-								data:    []byte{0x02},
+								data: []byte{byte(OptCodeI32Const), 0x01},
 							},
 							Init: []byte{0x01, 0x01},
 						},
 					},
 					SecMemory:  []*MemoryType{{}},
-					IndexSpace: &ModuleIndexSpace{Memory: [][]byte{{0x00, 0x00, 0x00}}},
+					IndexSpace: &ModuleIndexSpace{Memory: []*Memory{{Buffer: []byte{0x00, 0x00, 0x00, 0x00}}}},
 				},
-				exp: [][]byte{{0x00, 0x00, 0x01, 0x01}},
+				exp: [][]byte{{0x00, 0x01, 0x01, 0x00}},
 			},
 			{
 				m: &Module{
 					SecData: []*DataSegment{
 						{
 							OffsetExpression: &ConstantExpression{
-								optCode: OptCodeI32Const,
-								data:    []byte{0x01},
+								data: []byte{byte(OptCodeI32Const), 0x01},
 							},
-							Init: []byte{0x01, 0x01},
+							Init:        []byte{0x01, 0x01},
+							MemoryIndex: 1,
 						},
 					},
-					SecMemory:  []*MemoryType{{}},
-					IndexSpace: &ModuleIndexSpace{Memory: [][]byte{{0x00, 0x00, 0x00, 0x00}}},
+					SecMemory:  []*MemoryType{{}, {}},
+					IndexSpace: &ModuleIndexSpace{Memory: []*Memory{{Buffer: []byte{}}, {Buffer: []byte{0x00, 0x00, 0x00, 0x00}}}},
 				},
-				exp: [][]byte{{0x00, 0x01, 0x01, 0x00}},
+				exp: [][]byte{{}, {0x00, 0x01, 0x01, 0x00}},
 			},
 			{
 				m: &Module{
 					SecData: []*DataSegment{
 						{
-							OffsetExpression: &ConstantExpression{
-								optCode: OptCodeI32Const,
-								data:    []byte{0x01},
-							},
-							Init:        []byte{0x01, 0x01},
-							MemoryIndex: 1,
+							OffsetExpression: &ConstantExpression{data: []byte{
+								byte(OptCodeGlobalGet), 0x00, byte(OptCodeI32Const), 0x01, byte(OptCodeI32add),
+							}},
+							Init: []byte{0x01, 0x01},
 						},
 					},
-					SecMemory:  []*MemoryType{{}, {}},
-					IndexSpace: &ModuleIndexSpace{Memory: [][]byte{{}, {0x00, 0x00, 0x00, 0x00}}},
+					SecMemory: []*MemoryType{{}},
+					IndexSpace: &ModuleIndexSpace{
+						Memory:  []*Memory{{Buffer: []byte{0x00, 0x00, 0x00, 0x00}}},
+						Globals: []*Global{{Type: &GlobalType{Value: ValueTypeI32}, Val: 1}},
+					},
 				},
-				exp: [][]byte{{}, {0x00, 0x01, 0x01, 0x00}},
+				exp: [][]byte{{0x00, 0x00, 0x01, 0x01}},
 			},
 		} {
 			require.NoError(t, c.m.buildMemoryIndexSpace())
-			assert.Equal(t, c.exp, c.m.IndexSpace.Memory)
+			require.Len(t, c.m.IndexSpace.Memory, len(c.exp))
+			for i, exp := range c.exp {
+				assert.Equal(t, exp, c.m.IndexSpace.Memory[i].Buffer)
+			}
 		}
 	})
 }
 
 func TestModule_buildTableIndexSpace(t *testing.T) {
+	f0, f1, f2 := &NativeFunction{NumLocal: 0}, &NativeFunction{NumLocal: 1}, &NativeFunction{NumLocal: 2}
+	functions := []VirtualMachineFunction{f0, f1, f2}
+
 	t.Run("error", func(t *testing.T) {
 		for _, m := range []*Module{
 			{
@@ -406,27 +476,42 @@ func TestModule_buildTableIndexSpace(t *testing.T) {
 				IndexSpace:  new(ModuleIndexSpace),
 			},
 			{
-				SecElements: []*ElementSegment{{TableIndex: 0}},
-				IndexSpace:  &ModuleIndexSpace{Table: [][]*uint32{{}}},
+				SecElements: []*ElementSegment{{TableIndex: 0, OffsetExpr: &ConstantExpression{}}},
+				IndexSpace:  &ModuleIndexSpace{Table: []*Table{{}}},
 			},
 			{
-				SecElements: []*ElementSegment{{TableIndex: 0, OffsetExpr: &ConstantExpression{}}},
-				SecTables:   []*TableType{{}},
-				IndexSpace:  &ModuleIndexSpace{Table: [][]*uint32{{}}},
+				SecElements: []*ElementSegment{{
+					TableIndex: 0,
+					OffsetExpr: &ConstantExpression{data: []byte{byte(OptCodeI32Const), 0x0}},
+					Init:       []uint32{0x0, 0x0},
+				}},
+				IndexSpace: &ModuleIndexSpace{Table: []*Table{{Max: uint32Ptr(1)}}, Function: functions},
 			},
 			{
 				SecElements: []*ElementSegment{{
 					TableIndex: 0,
-					OffsetExpr: &ConstantExpression{
-						optCode: OptCodeI32Const,
-						data:    []byte{0x0},
-					},
-					Init: []uint32{0x0, 0x0},
+					OffsetExpr: &ConstantExpression{data: []byte{byte(OptCodeI32Const), 0x0}},
+					Init:       []uint32{0x10},
 				}},
-				SecTables: []*TableType{{Limit: &LimitsType{
-					Max: uint32Ptr(1),
-				}}},
-				IndexSpace: &ModuleIndexSpace{Table: [][]*uint32{{}}},
+				IndexSpace: &ModuleIndexSpace{Table: []*Table{NewTable(1, nil)}, Function: functions},
+			},
+			{
+				// the table doesn't grow to fit the segment
+				SecElements: []*ElementSegment{{
+					TableIndex: 0,
+					OffsetExpr: &ConstantExpression{data: []byte{byte(OptCodeI32Const), 0x1}},
+					Init:       []uint32{0x0, 0x0},
+				}},
+				IndexSpace: &ModuleIndexSpace{Table: []*Table{NewTable(2, nil)}, Function: functions},
+			},
+			{
+				// -1 is the offset 2^32-1
+				SecElements: []*ElementSegment{{
+					TableIndex: 0,
+					OffsetExpr: &ConstantExpression{data: []byte{byte(OptCodeI32Const), 0x7f}},
+					Init:       []uint32{0x0},
+				}},
+				IndexSpace: &ModuleIndexSpace{Table: []*Table{NewTable(2, nil)}, Function: functions},
 			},
 		} {
 			err := m.buildTableIndexSpace()
@@ -438,108 +523,90 @@ func TestModule_buildTableIndexSpace(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
 		for _, c := range []struct {
 			m   *Module
-			exp [][]*uint32
+			exp [][]VirtualMachineFunction
 		}{
 			{
 				m: &Module{
 					SecElements: []*ElementSegment{{
 						TableIndex: 0,
-						OffsetExpr: &ConstantExpression{
-							optCode: OptCodeI32Const,
-							data:    []byte{0x0},
-						},
-						Init: []uint32{0x1, 0x1},
+						OffsetExpr: &ConstantExpression{data: []byte{byte(OptCodeI32Const), 0x0}},
+						Init:       []uint32{0x1, 0x1},
 					}},
-					SecTables:  []*TableType{{Limit: &LimitsType{}}},
-					IndexSpace: &ModuleIndexSpace{Table: [][]*uint32{{}}},
+					IndexSpace: &ModuleIndexSpace{Table: []*Table{NewTable(2, nil)}, Function: functions},
 				},
-				exp: [][]*uint32{{uint32Ptr(0x01), uint32Ptr(0x01)}},
+				exp: [][]VirtualMachineFunction{{f1, f1}},
 			},
 			{
 				m: &Module{
 					SecElements: []*ElementSegment{{
 						TableIndex: 0,
-						OffsetExpr: &ConstantExpression{
-							optCode: OptCodeI32Const,
-							data:    []byte{0x0},
-						},
-						Init: []uint32{0x1, 0x1},
+						OffsetExpr: &ConstantExpression{data: []byte{byte(OptCodeI32Const), 0x0}},
+						Init:       []uint32{0x1, 0x1},
 					}},
-					SecTables: []*TableType{{Limit: &LimitsType{}}},
 					IndexSpace: &ModuleIndexSpace{
-						Table: [][]*uint32{{uint32Ptr(0x0), uint32Ptr(0x0)}},
+						Table:    []*Table{{Elements: []VirtualMachineFunction{f0, f0}}},
+						Function: functions,
 					},
 				},
-				exp: [][]*uint32{{uint32Ptr(0x01), uint32Ptr(0x01)}},
+				exp: [][]VirtualMachineFunction{{f1, f1}},
 			},
 			{
 				m: &Module{
 					SecElements: []*ElementSegment{{
 						TableIndex: 0,
-						OffsetExpr: &ConstantExpression{
-							optCode: OptCodeI32Const,
-							data:    []byte{0x1},
-						},
-						Init: []uint32{0x1, 0x1},
+						OffsetExpr: &ConstantExpression{data: []byte{byte(OptCodeI32Const), 0x1}},
+						Init:       []uint32{0x1, 0x1},
 					}},
-					SecTables: []*TableType{{Limit: &LimitsType{}}},
 					IndexSpace: &ModuleIndexSpace{
-						Table: [][]*uint32{{nil, uint32Ptr(0x0), uint32Ptr(0x0)}},
+						Table:    []*Table{{Elements: []VirtualMachineFunction{nil, f0, f0}}},
+						Function: functions,
 					},
 				},
-				exp: [][]*uint32{{nil, uint32Ptr(0x01), uint32Ptr(0x01)}},
+				exp: [][]VirtualMachineFunction{{nil, f1, f1}},
 			},
 			{
 				m: &Module{
 					SecElements: []*ElementSegment{{
 						TableIndex: 0,
-						OffsetExpr: &ConstantExpression{
-							optCode: OptCodeI32Const,
-							data:    []byte{0x1},
-						},
-						Init: []uint32{0x1},
+						OffsetExpr: &ConstantExpression{data: []byte{byte(OptCodeI32Const), 0x1}},
+						Init:       []uint32{0x1},
 					}},
-					SecTables: []*TableType{{Limit: &LimitsType{}}},
 					IndexSpace: &ModuleIndexSpace{
-						Table: [][]*uint32{{nil, nil, nil}},
+						Table:    []*Table{{Elements: []VirtualMachineFunction{nil, nil, nil}}},
+						Function: functions,
 					},
 				},
-				exp: [][]*uint32{{nil, uint32Ptr(0x01), nil}},
+				exp: [][]VirtualMachineFunction{{nil, f1, nil}},
 			},
 			{
 				m: &Module{
 					SecElements: []*ElementSegment{{
 						TableIndex: 0,
-						OffsetExpr: &ConstantExpression{
-							optCode: OptCodeI32Const,
-							data:    []byte{0x0},
-						},
-						Init: []uint32{0x1, 0x2},
+						OffsetExpr: &ConstantExpression{data: []byte{byte(OptCodeI32Const), 0x0}},
+						Init:       []uint32{0x1, 0x2},
 					}},
-					SecTables: []*TableType{{Limit: &LimitsType{}}},
-					IndexSpace: &ModuleIndexSpace{
-						Table: [][]*uint32{{}},
-					},
+					IndexSpace: &ModuleIndexSpace{Table: []*Table{NewTable(2, nil)}, Function: functions},
 				},
-				exp: [][]*uint32{{uint32Ptr(0x01), uint32Ptr(0x02)}},
+				exp: [][]VirtualMachineFunction{{f1, f2}},
 			},
 		} {
 			require.NoError(t, c.m.buildTableIndexSpace())
 			require.Len(t, c.m.IndexSpace.Table, len(c.exp))
 			for i, actualTable := range c.m.IndexSpace.Table {
 				expTable := c.exp[i]
-				require.Len(t, actualTable, len(expTable))
+				require.Len(t, actualTable.Elements, len(expTable))
 				for i, exp := range expTable {
 					if exp == nil {
-						assert.Nil(t, actualTable[i])
+						assert.Nil(t, actualTable.Elements[i])
 					} else {
-						assert.Equal(t, *exp, *actualTable[i])
+						assert.Same(t, exp, actualTable.Elements[i])
 					}
 				}
 			}
 		}
 	})
 }
+
 func TestModule_readBlockType(t *testing.T) {
 	for _, c := range []struct {
 		bytes []byte
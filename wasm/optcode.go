@@ -197,4 +197,8 @@ const (
 	OptCodeI64reinterpretf64 OptCode = 0xbd
 	OptCodeF32reinterpreti32 OptCode = 0xbe
 	OptCodeF64reinterpreti64 OptCode = 0xbf
+
+	// reference types; only valid in constant expressions for now
+	OptCodeRefNull OptCode = 0xd0
+	OptCodeRefFunc OptCode = 0xd2
 )
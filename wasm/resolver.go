@@ -0,0 +1,158 @@
+package wasm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrImportNotFound is returned by an ImportResolver which doesn't provide the import.
+var ErrImportNotFound = errors.New("import not found")
+
+type (
+	// ImportDescriptor describes an import of a module with its type.
+	// Only the type matching Kind is set.
+	ImportDescriptor struct {
+		Module, Name string
+		Kind         byte
+
+		FunctionType *FunctionType
+		Table        *TableType
+		Memory       *MemoryType
+		Global       *GlobalType
+	}
+
+	// Extern is an external value provided for an import.
+	// Only the field matching the kind of the import is set.
+	Extern struct {
+		Function VirtualMachineFunction
+		Table    *Table
+		Memory   *Memory
+		Global   *Global
+	}
+
+	// ImportResolver is consulted for each import of a module at instantiation.
+	// It must return an error wrapping ErrImportNotFound if it doesn't provide the import,
+	// which allows composing resolvers with ChainResolvers.
+	ImportResolver interface {
+		ResolveImport(desc *ImportDescriptor) (*Extern, error)
+	}
+
+	// ImportResolverFunc is an adapter to use a function as ImportResolver.
+	ImportResolverFunc func(desc *ImportDescriptor) (*Extern, error)
+
+	// ModuleResolver resolves imports with the exports of modules keyed by their names.
+	// The modules must be instantiated, or built by hostfunc.ModuleBuilder.
+	ModuleResolver map[string]*Module
+
+	chainResolver []ImportResolver
+
+	stubResolver struct{}
+)
+
+var (
+	_ ImportResolver = ImportResolverFunc(nil)
+	_ ImportResolver = ModuleResolver{}
+	_ ImportResolver = chainResolver{}
+	_ ImportResolver = stubResolver{}
+)
+
+func (f ImportResolverFunc) ResolveImport(desc *ImportDescriptor) (*Extern, error) {
+	return f(desc)
+}
+
+func (r ModuleResolver) ResolveImport(desc *ImportDescriptor) (*Extern, error) {
+	em, ok := r[desc.Module]
+	if !ok {
+		return nil, fmt.Errorf("%w: module %s", ErrImportNotFound, desc.Module)
+	}
+
+	if em.IndexSpace == nil {
+		return nil, fmt.Errorf("module %s is not instantiated", desc.Module)
+	}
+
+	es, ok := em.SecExports[desc.Name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not exported in module %s", ErrImportNotFound, desc.Name, desc.Module)
+	}
+
+	if desc.Kind != es.Desc.Kind {
+		return nil, fmt.Errorf("type mismatch on export: got %#x but want %#x", es.Desc.Kind, desc.Kind)
+	}
+	return em.exportedExtern(es.Desc)
+}
+
+// ChainResolvers returns the resolver which consults the given resolvers in order
+// until one of them provides the import.
+func ChainResolvers(resolvers ...ImportResolver) ImportResolver {
+	return chainResolver(resolvers)
+}
+
+func (c chainResolver) ResolveImport(desc *ImportDescriptor) (*Extern, error) {
+	for _, r := range c {
+		ext, err := r.ResolveImport(desc)
+		if errors.Is(err, ErrImportNotFound) {
+			continue
+		}
+		return ext, err
+	}
+	return nil, fmt.Errorf("%w: %s.%s", ErrImportNotFound, desc.Module, desc.Name)
+}
+
+// StubResolver returns the resolver which satisfies any import with a stand-in so that
+// modules can be instantiated without all of their imports, e.g. to test some of their exports.
+// Stub functions trap with "unimplemented import module.name" when called, and globals,
+// memories and tables are zero-valued (null for references). It is meant to be the last of ChainResolvers.
+func StubResolver() ImportResolver {
+	return stubResolver{}
+}
+
+func (stubResolver) ResolveImport(desc *ImportDescriptor) (*Extern, error) {
+	switch desc.Kind {
+	case ExportKindFunction:
+		msg := fmt.Sprintf("unimplemented import %s.%s", desc.Module, desc.Name)
+		return &Extern{Function: &RawHostFunction{
+			Signature: desc.FunctionType,
+			Function: func(*VirtualMachine, []uint64, []uint64) error {
+				panic(msg)
+			},
+		}}, nil
+	case ExportKindTable:
+		return &Extern{Table: NewTable(desc.Table.Limit.Min, desc.Table.Limit.Max)}, nil
+	case ExportKindMem:
+		return &Extern{Memory: NewMemory(desc.Memory.Min, desc.Memory.Max)}, nil
+	case ExportKindGlobal:
+		g := &Global{Type: desc.Global}
+		if vt := desc.Global.Value; vt == ValueTypeFuncref || vt == ValueTypeExternref {
+			g.Val = refNull
+		}
+		return &Extern{Global: g}, nil
+	default:
+		return nil, fmt.Errorf("invalid kind of import: %#x", desc.Kind)
+	}
+}
+
+// exportedExtern returns the value of the export in the module's index spaces.
+func (m *Module) exportedExtern(desc *ExportDesc) (*Extern, error) {
+	is := m.IndexSpace
+	switch desc.Kind {
+	case ExportKindFunction:
+		if desc.Index < uint32(len(is.Function)) {
+			return &Extern{Function: is.Function[desc.Index]}, nil
+		}
+	case ExportKindTable:
+		if desc.Index < uint32(len(is.Table)) {
+			return &Extern{Table: is.Table[desc.Index]}, nil
+		}
+	case ExportKindMem:
+		if desc.Index < uint32(len(is.Memory)) {
+			return &Extern{Memory: is.Memory[desc.Index]}, nil
+		}
+	case ExportKindGlobal:
+		if desc.Index < uint32(len(is.Globals)) {
+			return &Extern{Global: is.Globals[desc.Index]}, nil
+		}
+	default:
+		return nil, fmt.Errorf("invalid kind of export: %#x", desc.Kind)
+	}
+	return nil, fmt.Errorf("exported index out of range")
+}
@@ -0,0 +1,204 @@
+package wasm
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModuleResolver_ResolveImport(t *testing.T) {
+	f := &NativeFunction{Signature: &FunctionType{}}
+	table, mem := NewTable(1, nil), NewMemory(1, nil)
+	g := &Global{Type: &GlobalType{Value: ValueTypeI32}}
+	r := ModuleResolver{
+		"a": {
+			SecExports: map[string]*ExportSegment{
+				"f":       {Name: "f", Desc: &ExportDesc{Kind: ExportKindFunction}},
+				"table":   {Name: "table", Desc: &ExportDesc{Kind: ExportKindTable}},
+				"memory":  {Name: "memory", Desc: &ExportDesc{Kind: ExportKindMem}},
+				"global":  {Name: "global", Desc: &ExportDesc{Kind: ExportKindGlobal}},
+				"invalid": {Name: "invalid", Desc: &ExportDesc{Kind: ExportKindGlobal, Index: 10}},
+			},
+			IndexSpace: &ModuleIndexSpace{
+				Function: []VirtualMachineFunction{f},
+				Table:    []*Table{table},
+				Memory:   []*Memory{mem},
+				Globals:  []*Global{g},
+			},
+		},
+		"not_instantiated": {},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		for _, c := range []struct {
+			desc *ImportDescriptor
+			exp  *Extern
+		}{
+			{desc: &ImportDescriptor{Module: "a", Name: "f", Kind: ExportKindFunction}, exp: &Extern{Function: f}},
+			{desc: &ImportDescriptor{Module: "a", Name: "table", Kind: ExportKindTable}, exp: &Extern{Table: table}},
+			{desc: &ImportDescriptor{Module: "a", Name: "memory", Kind: ExportKindMem}, exp: &Extern{Memory: mem}},
+			{desc: &ImportDescriptor{Module: "a", Name: "global", Kind: ExportKindGlobal}, exp: &Extern{Global: g}},
+		} {
+			actual, err := r.ResolveImport(c.desc)
+			require.NoError(t, err)
+			assert.Equal(t, c.exp, actual)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		for _, c := range []struct {
+			desc     *ImportDescriptor
+			notFound bool
+		}{
+			{desc: &ImportDescriptor{Module: "b", Name: "f"}, notFound: true},
+			{desc: &ImportDescriptor{Module: "a", Name: "g"}, notFound: true},
+			{desc: &ImportDescriptor{Module: "not_instantiated", Name: "f"}},
+			{desc: &ImportDescriptor{Module: "a", Name: "f", Kind: ExportKindMem}},
+			{desc: &ImportDescriptor{Module: "a", Name: "invalid", Kind: ExportKindGlobal}},
+		} {
+			_, err := r.ResolveImport(c.desc)
+			require.Error(t, err)
+			assert.Equal(t, c.notFound, errors.Is(err, ErrImportNotFound))
+		}
+	})
+}
+
+func TestChainResolvers(t *testing.T) {
+	g1 := &Global{Type: &GlobalType{Value: ValueTypeI32}}
+	g2 := &Global{Type: &GlobalType{Value: ValueTypeI32}}
+	errFailed := errors.New("failed")
+	r := ChainResolvers(
+		ModuleResolver{"a": {
+			SecExports: map[string]*ExportSegment{"g": {Name: "g", Desc: &ExportDesc{Kind: ExportKindGlobal}}},
+			IndexSpace: &ModuleIndexSpace{Globals: []*Global{g1}},
+		}},
+		ImportResolverFunc(func(desc *ImportDescriptor) (*Extern, error) {
+			switch desc.Name {
+			case "g":
+				return &Extern{Global: g2}, nil
+			case "fail":
+				return nil, errFailed
+			}
+			return nil, ErrImportNotFound
+		}),
+	)
+
+	actual, err := r.ResolveImport(&ImportDescriptor{Module: "a", Name: "g", Kind: ExportKindGlobal})
+	require.NoError(t, err)
+	assert.Same(t, g1, actual.Global)
+
+	// falls back to the next resolver
+	actual, err = r.ResolveImport(&ImportDescriptor{Module: "b", Name: "g", Kind: ExportKindGlobal})
+	require.NoError(t, err)
+	assert.Same(t, g2, actual.Global)
+
+	_, err = r.ResolveImport(&ImportDescriptor{Module: "b", Name: "fail"})
+	assert.Equal(t, errFailed, err)
+
+	_, err = r.ResolveImport(&ImportDescriptor{Module: "b", Name: "h"})
+	assert.True(t, errors.Is(err, ErrImportNotFound))
+}
+
+func TestNewVMWithResolver(t *testing.T) {
+	var called []string
+	// resolves any function of the "env" namespace on demand
+	r := ImportResolverFunc(func(desc *ImportDescriptor) (*Extern, error) {
+		if desc.Module != "env" || desc.Kind != ExportKindFunction {
+			return nil, ErrImportNotFound
+		}
+		return &Extern{Function: &HostFunction{
+			ClosureGenerator: func(*VirtualMachine) reflect.Value {
+				return reflect.ValueOf(func() { called = append(called, desc.Name) })
+			},
+			Signature: desc.FunctionType,
+		}}, nil
+	})
+
+	m := &Module{
+		SecTypes: []*FunctionType{{}},
+		SecImports: []*ImportSegment{
+			{Module: "env", Name: "foo", Desc: &ImportDesc{Kind: ExportKindFunction, TypeIndexPtr: uint32Ptr(0)}},
+			{Module: "env", Name: "bar", Desc: &ImportDesc{Kind: ExportKindFunction, TypeIndexPtr: uint32Ptr(0)}},
+		},
+		SecExports: map[string]*ExportSegment{
+			"bar": {Name: "bar", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 1}},
+		},
+	}
+	vm, err := NewVMWithResolver(m, r)
+	require.NoError(t, err)
+	_, _, err = vm.ExecExportedFunction("bar")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bar"}, called)
+
+	m = &Module{
+		SecTypes: m.SecTypes,
+		SecImports: append(m.SecImports,
+			&ImportSegment{Module: "other", Name: "x", Desc: &ImportDesc{Kind: ExportKindFunction, TypeIndexPtr: uint32Ptr(0)}},
+			&ImportSegment{Module: "other", Name: "y", Desc: &ImportDesc{Kind: ExportKindMem, MemTypePtr: &MemoryType{}}},
+		),
+	}
+	_, err = NewVMWithResolver(m, r)
+	require.True(t, errors.Is(err, ErrImportNotFound))
+	assert.True(t, strings.HasSuffix(err.Error(), "other.x, other.y"))
+}
+
+func TestStubResolver(t *testing.T) {
+	g := &Global{Type: &GlobalType{Value: ValueTypeI32}, Val: 1}
+	m := &Module{
+		SecTypes: []*FunctionType{
+			{InputTypes: []ValueType{ValueTypeI32}, ReturnTypes: []ValueType{ValueTypeI32}},
+			{ReturnTypes: []ValueType{ValueTypeI32}},
+		},
+		SecImports: []*ImportSegment{
+			{Module: "env", Name: "f", Desc: &ImportDesc{Kind: ExportKindFunction, TypeIndexPtr: uint32Ptr(0)}},
+			{Module: "env", Name: "table", Desc: &ImportDesc{
+				Kind: ExportKindTable, TableTypePtr: &TableType{Limit: &LimitsType{Min: 2}},
+			}},
+			{Module: "env", Name: "memory", Desc: &ImportDesc{Kind: ExportKindMem, MemTypePtr: &MemoryType{Min: 1}}},
+			{Module: "env", Name: "stub", Desc: &ImportDesc{Kind: ExportKindGlobal, GlobalTypePtr: &GlobalType{
+				Value: ValueTypeI64, Mutable: true,
+			}}},
+			{Module: "env", Name: "provided", Desc: &ImportDesc{Kind: ExportKindGlobal, GlobalTypePtr: &GlobalType{
+				Value: ValueTypeI32,
+			}}},
+		},
+		SecFunctions: []uint32{1, 1, 1},
+		SecCodes: []*CodeSegment{
+			{Body: []byte{byte(OptCodeI32Const), 0x00, byte(OptCodeCall), 0x00}},
+			{Body: []byte{byte(OptCodeGlobalGet), 0x01}},
+			{Body: []byte{byte(OptCodeMemorySize), 0x00}},
+		},
+		SecExports: map[string]*ExportSegment{
+			"call_f":   {Name: "call_f", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 1}},
+			"provided": {Name: "provided", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 2}},
+			"size":     {Name: "size", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 3}},
+		},
+	}
+
+	vm, err := NewVMWithResolver(m, ChainResolvers(ModuleResolver{"env": {
+		SecExports: map[string]*ExportSegment{"provided": {Name: "provided", Desc: &ExportDesc{Kind: ExportKindGlobal}}},
+		IndexSpace: &ModuleIndexSpace{Globals: []*Global{g}},
+	}}, StubResolver()))
+	require.NoError(t, err)
+
+	// provided imports take precedence over the stubs
+	ret, _, err := vm.ExecExportedFunction("provided")
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1}, ret)
+
+	ret, _, err = vm.ExecExportedFunction("size")
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1}, ret)
+	assert.Len(t, vm.InnerModule.IndexSpace.Table[0].Elements, 2)
+	assert.Equal(t, &GlobalType{Value: ValueTypeI64, Mutable: true}, vm.Globals[0].Type)
+	assert.Equal(t, uint64(0), vm.Globals[0].Val)
+
+	require.PanicsWithValue(t, "unimplemented import env.f", func() {
+		_, _, _ = vm.ExecExportedFunction("call_f")
+	})
+	require.Equal(t, -1, vm.OperandStack.SP)
+}
@@ -85,8 +85,7 @@ func TestReadGlobalSegment(t *testing.T) {
 	exp := &GlobalSegment{
 		Type: &GlobalType{Value: ValueTypeI64, Mutable: false},
 		Init: &ConstantExpression{
-			optCode: OptCodeI64Const,
-			data:    []byte{0x01},
+			data: []byte{byte(OptCodeI64Const), 0x01},
 		},
 	}
 
@@ -159,8 +158,7 @@ func TestReadElementSegment(t *testing.T) {
 			exp: &ElementSegment{
 				TableIndex: 10,
 				OffsetExpr: &ConstantExpression{
-					optCode: OptCodeI32Const,
-					data:    []byte{0x01},
+					data: []byte{byte(OptCodeI32Const), 0x01},
 				},
 				Init: []uint32{5, 7},
 			},
@@ -170,8 +168,7 @@ func TestReadElementSegment(t *testing.T) {
 			exp: &ElementSegment{
 				TableIndex: 3,
 				OffsetExpr: &ConstantExpression{
-					optCode: OptCodeI32Const,
-					data:    []byte{0x04},
+					data: []byte{byte(OptCodeI32Const), 0x04},
 				},
 				Init: []uint32{10},
 			},
@@ -205,8 +202,7 @@ func TestDataSegment(t *testing.T) {
 			bytes: []byte{0x0, 0x41, 0x1, 0x0b, 0x02, 0x05, 0x07},
 			exp: &DataSegment{
 				OffsetExpression: &ConstantExpression{
-					optCode: OptCodeI32Const,
-					data:    []byte{0x01},
+					data: []byte{byte(OptCodeI32Const), 0x01},
 				},
 				Init: []byte{5, 7},
 			},
@@ -215,8 +211,16 @@ func TestDataSegment(t *testing.T) {
 			bytes: []byte{0x0, 0x41, 0x04, 0x0b, 0x01, 0x0a},
 			exp: &DataSegment{
 				OffsetExpression: &ConstantExpression{
-					optCode: OptCodeI32Const,
-					data:    []byte{0x04},
+					data: []byte{byte(OptCodeI32Const), 0x04},
+				},
+				Init: []byte{0x0a},
+			},
+		},
+		{
+			bytes: []byte{0x0, 0x23, 0x00, 0x41, 0x04, 0x6a, 0x0b, 0x01, 0x0a},
+			exp: &DataSegment{
+				OffsetExpression: &ConstantExpression{
+					data: []byte{byte(OptCodeGlobalGet), 0x00, byte(OptCodeI32Const), 0x04, byte(OptCodeI32add)},
 				},
 				Init: []byte{0x0a},
 			},
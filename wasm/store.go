@@ -0,0 +1,55 @@
+package wasm
+
+import "fmt"
+
+// Store links multiple modules together. Each instantiated module gets its own
+// VirtualMachine (memory, globals and tables), and its exports become importable by
+// modules instantiated afterwards. Calls into functions of another instance are
+// executed against the callee's state.
+type Store struct {
+	modules   map[string]*Module
+	instances map[string]*VirtualMachine
+}
+
+func NewStore() *Store {
+	return &Store{
+		modules:   map[string]*Module{},
+		instances: map[string]*VirtualMachine{},
+	}
+}
+
+// AddHostModules registers modules built by the host such as the ones returned by
+// hostfunc.ModuleBuilder's Done so that they can be imported by instantiated modules.
+func (s *Store) AddHostModules(modules map[string]*Module) error {
+	for name, m := range modules {
+		if _, ok := s.modules[name]; ok {
+			return fmt.Errorf("module %s already exists", name)
+		}
+		s.modules[name] = m
+	}
+	return nil
+}
+
+// Instantiate instantiates the module by resolving its imports against the modules in the store,
+// and registers it with the given name so that subsequent instantiations can import its exports.
+// The same module can be instantiated under several names, each instance having its own state.
+func (s *Store) Instantiate(name string, module *Module) (*VirtualMachine, error) {
+	if _, ok := s.modules[name]; ok {
+		return nil, fmt.Errorf("module %s already exists", name)
+	}
+
+	vm, err := NewVM(module, s.modules)
+	if err != nil {
+		return nil, fmt.Errorf("instantiate %s: %w", name, err)
+	}
+
+	s.modules[name] = vm.InnerModule
+	s.instances[name] = vm
+	return vm, nil
+}
+
+// Instance returns the virtual machine instantiated with the given name.
+func (s *Store) Instance(name string) (vm *VirtualMachine, ok bool) {
+	vm, ok = s.instances[name]
+	return
+}
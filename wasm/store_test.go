@@ -0,0 +1,133 @@
+package wasm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Instantiate(t *testing.T) {
+	types := []*FunctionType{
+		{ReturnTypes: []ValueType{ValueTypeI32}},
+		{InputTypes: []ValueType{ValueTypeI32}, ReturnTypes: []ValueType{ValueTypeI32}},
+	}
+	i32Global := func(v byte) *GlobalSegment {
+		return &GlobalSegment{
+			Type: &GlobalType{Value: ValueTypeI32},
+			Init: &ConstantExpression{data: []byte{byte(OptCodeI32Const), v}},
+		}
+	}
+
+	// "a" defines a table which is called through by index, and a function returning its own global
+	a := &Module{
+		SecTypes:     types,
+		SecFunctions: []uint32{0, 1},
+		SecCodes: []*CodeSegment{
+			{Body: []byte{byte(OptCodeGlobalGet), 0x00}},
+			{Body: []byte{byte(OptCodeLocalGet), 0x00, byte(OptCodeCallIndirect), 0x00, 0x00}},
+		},
+		SecGlobals: []*GlobalSegment{i32Global(42)},
+		SecTables:  []*TableType{{Limit: &LimitsType{Min: 2}}},
+		SecExports: map[string]*ExportSegment{
+			"get_global": {Name: "get_global", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 0}},
+			"call":       {Name: "call", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 1}},
+			"table":      {Name: "table", Desc: &ExportDesc{Kind: ExportKindTable, Index: 0}},
+		},
+	}
+
+	// "b" imports a's function and table, and puts its own function into the table
+	b := &Module{
+		SecTypes: types,
+		SecImports: []*ImportSegment{
+			{Module: "a", Name: "get_global", Desc: &ImportDesc{Kind: ExportKindFunction, TypeIndexPtr: uint32Ptr(0)}},
+			{Module: "a", Name: "table", Desc: &ImportDesc{Kind: ExportKindTable, TableTypePtr: &TableType{Limit: &LimitsType{}}}},
+		},
+		SecFunctions: []uint32{0},
+		SecCodes:     []*CodeSegment{{Body: []byte{byte(OptCodeGlobalGet), 0x00}}},
+		SecGlobals:   []*GlobalSegment{i32Global(7)},
+		SecElements: []*ElementSegment{
+			{OffsetExpr: &ConstantExpression{data: []byte{byte(OptCodeI32Const), 0x00}}, Init: []uint32{1, 0}},
+		},
+		SecExports: map[string]*ExportSegment{
+			"call_a": {Name: "call_a", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 0}},
+			"own":    {Name: "own", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 1}},
+		},
+	}
+
+	s := NewStore()
+	vmA, err := s.Instantiate("a", a)
+	require.NoError(t, err)
+	vmB, err := s.Instantiate("b", b)
+	require.NoError(t, err)
+
+	actual, ok := s.Instance("b")
+	require.True(t, ok)
+	require.Equal(t, vmB, actual)
+
+	for _, c := range []struct {
+		vm   *VirtualMachine
+		name string
+		args []uint64
+		exp  uint64
+	}{
+		{vm: vmA, name: "get_global", exp: 42},
+		{vm: vmB, name: "own", exp: 7},
+		// imported function must be executed with a's globals
+		{vm: vmB, name: "call_a", exp: 42},
+		// b's function in the shared table must be executed with b's globals
+		{vm: vmA, name: "call", args: []uint64{0}, exp: 7},
+		{vm: vmA, name: "call", args: []uint64{1}, exp: 42},
+	} {
+		ret, _, err := c.vm.ExecExportedFunction(c.name, c.args...)
+		require.NoError(t, err)
+		require.Equal(t, c.exp, ret[0])
+		require.Equal(t, -1, vmA.OperandStack.SP)
+		require.Equal(t, -1, vmB.OperandStack.SP)
+	}
+
+	_, err = s.Instantiate("a", &Module{})
+	require.Error(t, err)
+
+	// another instance of a has its own state
+	table, err := vmA.Table("table")
+	require.NoError(t, err)
+	vmA2, err := s.Instantiate("a2", a)
+	require.NoError(t, err)
+	actual, ok = s.Instance("a2")
+	require.True(t, ok)
+	require.Equal(t, vmA2, actual)
+	require.NotSame(t, a, vmA2.InnerModule)
+
+	table2, err := vmA2.Table("table")
+	require.NoError(t, err)
+	require.NotSame(t, table, table2)
+	actualTable, err := vmA.Table("table")
+	require.NoError(t, err)
+	require.Same(t, table, actualTable)
+
+	require.NotSame(t, vmA.Globals[0], vmA2.Globals[0])
+	vmA2.Globals[0].Val = 1
+	for _, c := range []struct {
+		vm  *VirtualMachine
+		exp uint64
+	}{{vm: vmA, exp: 42}, {vm: vmA2, exp: 1}} {
+		ret, _, err := c.vm.ExecExportedFunction("get_global")
+		require.NoError(t, err)
+		require.Equal(t, c.exp, ret[0])
+	}
+
+	// modules importing a2 are linked to the second instance
+	c := &Module{
+		SecImports: []*ImportSegment{
+			{Module: "a2", Name: "table", Desc: &ImportDesc{Kind: ExportKindTable, TableTypePtr: &TableType{Limit: &LimitsType{}}}},
+		},
+		SecExports: map[string]*ExportSegment{
+			"table": {Name: "table", Desc: &ExportDesc{Kind: ExportKindTable, Index: 0}},
+		},
+	}
+	vmC, err := s.Instantiate("c", c)
+	require.NoError(t, err)
+	actualTable, err = vmC.Table("table")
+	require.NoError(t, err)
+	require.Same(t, table2, actualTable)
+}
@@ -0,0 +1,75 @@
+package wasm
+
+import (
+	"fmt"
+	"math"
+)
+
+// Table is a table instance. It is shared by reference between the exporting
+// and importing modules, and its elements are functions bound to the instance
+// which defines them so that call_indirect works across instances.
+type Table struct {
+	// Elements holds the functions of the table; nil for uninitialized elements
+	Elements []VirtualMachineFunction
+	Max      *uint32
+}
+
+// NewTable allocates a table of min uninitialized elements.
+func NewTable(min uint32, max *uint32) *Table {
+	return &Table{Elements: make([]VirtualMachineFunction, min), Max: max}
+}
+
+// Size returns the current number of elements.
+func (t *Table) Size() uint32 {
+	return uint32(len(t.Elements))
+}
+
+// Get returns the element at index, which is nil if uninitialized.
+// ok is false if the index is out of range.
+func (t *Table) Get(index uint32) (f VirtualMachineFunction, ok bool) {
+	if index >= t.Size() {
+		return nil, false
+	}
+	return t.Elements[index], true
+}
+
+// Set sets the element at index; nil clears it. It returns false if the index is out of range.
+func (t *Table) Set(index uint32, f VirtualMachineFunction) bool {
+	if index >= t.Size() {
+		return false
+	}
+	t.Elements[index] = f
+	return true
+}
+
+// Grow grows the table by delta elements initialized with init, and returns the previous size.
+// ok is false if the result exceeds the maximum, in which case the table is left unchanged.
+func (t *Table) Grow(delta uint32, init VirtualMachineFunction) (previous uint32, ok bool) {
+	previous = t.Size()
+	max := uint64(math.MaxUint32)
+	if t.Max != nil {
+		max = uint64(*t.Max)
+	}
+
+	if uint64(previous)+uint64(delta) > max {
+		return previous, false
+	}
+
+	for i := uint32(0); i < delta; i++ {
+		t.Elements = append(t.Elements, init)
+	}
+	return previous, true
+}
+
+// function returns the initialized element at index to be called indirectly.
+func (t *Table) function(index uint64) (VirtualMachineFunction, error) {
+	if index >= uint64(len(t.Elements)) {
+		return nil, fmt.Errorf("table index out of range")
+	}
+
+	f := t.Elements[index]
+	if f == nil {
+		return nil, fmt.Errorf("table entry not initialized")
+	}
+	return f, nil
+}
@@ -0,0 +1,38 @@
+package wasm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTable(t *testing.T) {
+	table := NewTable(2, uint32Ptr(4))
+	require.Equal(t, uint32(2), table.Size())
+
+	f := &NativeFunction{Signature: &FunctionType{}}
+	require.True(t, table.Set(1, f))
+	require.False(t, table.Set(2, f))
+
+	actual, ok := table.Get(0)
+	require.True(t, ok)
+	assert.Nil(t, actual)
+	actual, ok = table.Get(1)
+	require.True(t, ok)
+	assert.Equal(t, f, actual)
+	_, ok = table.Get(2)
+	assert.False(t, ok)
+
+	prev, ok := table.Grow(2, f)
+	require.True(t, ok)
+	assert.Equal(t, uint32(2), prev)
+	assert.Equal(t, uint32(4), table.Size())
+	actual, _ = table.Get(3)
+	assert.Equal(t, f, actual)
+
+	prev, ok = table.Grow(1, nil)
+	require.False(t, ok)
+	assert.Equal(t, uint32(4), prev)
+	assert.Equal(t, uint32(4), table.Size())
+}
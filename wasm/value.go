@@ -3,6 +3,8 @@ package wasm
 import (
 	"fmt"
 	"io"
+	"math"
+	"reflect"
 
 	"github.com/mathetake/gasm/wasm/leb128"
 )
@@ -14,8 +16,96 @@ const (
 	ValueTypeI64 ValueType = 0x7e
 	ValueTypeF32 ValueType = 0x7d
 	ValueTypeF64 ValueType = 0x7c
+
+	ValueTypeFuncref   ValueType = 0x70
+	ValueTypeExternref ValueType = 0x6f
 )
 
+// Value is a typed value passed to and returned from functions.
+// Use the constructors I32, I64, F32 and F64 to create one.
+type Value struct {
+	valueType ValueType
+	raw       uint64
+}
+
+// I32 returns an i32 value. Like i32.const, it is sign-extended in its raw representation.
+func I32(v int32) Value {
+	return Value{valueType: ValueTypeI32, raw: uint64(v)}
+}
+
+func I64(v int64) Value {
+	return Value{valueType: ValueTypeI64, raw: uint64(v)}
+}
+
+func F32(v float32) Value {
+	return Value{valueType: ValueTypeF32, raw: uint64(math.Float32bits(v))}
+}
+
+func F64(v float64) Value {
+	return Value{valueType: ValueTypeF64, raw: math.Float64bits(v)}
+}
+
+// NewValue returns a value from its raw representation on the operand stack.
+func NewValue(valueType ValueType, raw uint64) Value {
+	return Value{valueType: valueType, raw: raw}
+}
+
+func (v Value) Type() ValueType {
+	return v.valueType
+}
+
+// Raw returns the representation of the value on the operand stack.
+func (v Value) Raw() uint64 {
+	return v.raw
+}
+
+func (v Value) I32() int32 {
+	return int32(v.raw)
+}
+
+func (v Value) I64() int64 {
+	return int64(v.raw)
+}
+
+func (v Value) F32() float32 {
+	return math.Float32frombits(uint32(v.raw))
+}
+
+func (v Value) F64() float64 {
+	return math.Float64frombits(v.raw)
+}
+
+func (v Value) String() string {
+	switch v.valueType {
+	case ValueTypeI32:
+		return fmt.Sprintf("i32(%d)", v.I32())
+	case ValueTypeI64:
+		return fmt.Sprintf("i64(%d)", v.I64())
+	case ValueTypeF32:
+		return fmt.Sprintf("f32(%v)", v.F32())
+	case ValueTypeF64:
+		return fmt.Sprintf("f64(%v)", v.F64())
+	default:
+		return fmt.Sprintf("%#x(%#x)", byte(v.valueType), v.raw)
+	}
+}
+
+// ValueTypeOf returns the value type which corresponds to the kind of Go value.
+func ValueTypeOf(kind reflect.Kind) (ValueType, error) {
+	switch kind {
+	case reflect.Float64:
+		return ValueTypeF64, nil
+	case reflect.Float32:
+		return ValueTypeF32, nil
+	case reflect.Int32, reflect.Uint32:
+		return ValueTypeI32, nil
+	case reflect.Int64, reflect.Uint64:
+		return ValueTypeI64, nil
+	default:
+		return 0x00, fmt.Errorf("invalid type: %s", kind.String())
+	}
+}
+
 func readValueTypes(r io.Reader, num uint32) ([]ValueType, error) {
 	ret := make([]ValueType, num)
 	buf := make([]byte, num)
@@ -26,7 +116,7 @@ func readValueTypes(r io.Reader, num uint32) ([]ValueType, error) {
 
 	for i, v := range buf {
 		switch vt := ValueType(v); vt {
-		case ValueTypeI32, ValueTypeF32, ValueTypeI64, ValueTypeF64:
+		case ValueTypeI32, ValueTypeF32, ValueTypeI64, ValueTypeF64, ValueTypeFuncref, ValueTypeExternref:
 			ret[i] = vt
 		default:
 			return nil, fmt.Errorf("invalid value type: %d", vt)
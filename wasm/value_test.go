@@ -2,6 +2,7 @@ package wasm
 
 import (
 	"bytes"
+	"math"
 	"strconv"
 	"testing"
 
@@ -59,3 +60,25 @@ func TestHasSameValues(t *testing.T) {
 		assert.Equal(t, c.exp, hasSameSignature(c.a, c.b))
 	}
 }
+
+func TestValue(t *testing.T) {
+	for _, c := range []struct {
+		v      Value
+		exp    interface{}
+		actual func(v Value) interface{}
+		vt     ValueType
+		raw    uint64
+		str    string
+	}{
+		{v: I32(-1), exp: int32(-1), actual: func(v Value) interface{} { return v.I32() }, vt: ValueTypeI32, raw: math.MaxUint64, str: "i32(-1)"},
+		{v: I64(-2), exp: int64(-2), actual: func(v Value) interface{} { return v.I64() }, vt: ValueTypeI64, raw: math.MaxUint64 - 1, str: "i64(-2)"},
+		{v: F32(1.5), exp: float32(1.5), actual: func(v Value) interface{} { return v.F32() }, vt: ValueTypeF32, raw: uint64(math.Float32bits(1.5)), str: "f32(1.5)"},
+		{v: F64(2.5), exp: 2.5, actual: func(v Value) interface{} { return v.F64() }, vt: ValueTypeF64, raw: math.Float64bits(2.5), str: "f64(2.5)"},
+	} {
+		assert.Equal(t, c.exp, c.actual(c.v))
+		assert.Equal(t, c.vt, c.v.Type())
+		assert.Equal(t, c.raw, c.v.Raw())
+		assert.Equal(t, c.str, c.v.String())
+		assert.Equal(t, c.v, NewValue(c.vt, c.raw))
+	}
+}
@@ -5,19 +5,25 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"reflect"
 
 	"github.com/mathetake/gasm/wasm/leb128"
 )
 
-const vmPageSize = 65536
+const (
+	vmPageSize = 65536
+
+	// refNull is the raw representation of a null reference
+	refNull = math.MaxUint64
+)
 
 type (
 	VirtualMachine struct {
 		InnerModule   *Module
 		ActiveContext *NativeFunctionContext
 		Functions     []VirtualMachineFunction
-		Memory        []byte
-		Globals       []uint64
+		Memory        *Memory
+		Globals       []*Global
 
 		OperandStack *VirtualMachineOperandStack
 		// used to store runtime data per VirtualMachine
@@ -29,11 +35,31 @@ type (
 		Function   *NativeFunction
 		Locals     []uint64
 		LabelStack *VirtualMachineLabelStack
+
+		caller *NativeFunctionContext
 	}
 )
 
+// NewVM instantiates the module with its imports resolved from the exports of externModules.
 func NewVM(module *Module, externModules map[string]*Module) (*VirtualMachine, error) {
-	if err := module.buildIndexSpaces(externModules); err != nil {
+	return NewVMWithResolver(module, ModuleResolver(externModules))
+}
+
+// NewVMWithResolver instantiates the module with its imports resolved by the resolver.
+// If some imports are not found, the returned error wraps ErrImportNotFound and lists all of them.
+// The instance's state is held by the module in its index spaces. If the module is already
+// instantiated, the new instance is built on a copy sharing the decoded sections, and the
+// module keeps the state of its first instance. The module of an instance is its InnerModule.
+func NewVMWithResolver(module *Module, resolver ImportResolver) (*VirtualMachine, error) {
+	if module.IndexSpace != nil {
+		instance := *module
+		instance.IndexSpace = nil
+		module = &instance
+	}
+
+	if err := module.buildIndexSpaces(resolver); err != nil {
+		// allow retrying with other imports
+		module.IndexSpace = nil
 		return nil, fmt.Errorf("build index space: %w", err)
 	}
 
@@ -44,65 +70,242 @@ func NewVM(module *Module, externModules map[string]*Module) (*VirtualMachine, e
 
 	// initialize vm memory
 	// note: MVP restricts vm to have a single memory space
-	vm.Memory = vm.InnerModule.IndexSpace.Memory[0]
-	if diff := uint64(vm.InnerModule.SecMemory[0].Min)*vmPageSize - uint64(len(vm.Memory)); diff > 0 {
-		vm.Memory = append(vm.Memory, make([]byte, diff)...)
+	if len(vm.InnerModule.IndexSpace.Memory) > 0 {
+		vm.Memory = vm.InnerModule.IndexSpace.Memory[0]
 	}
 
 	// initialize functions
-	vm.Functions = make([]VirtualMachineFunction, len(vm.InnerModule.IndexSpace.Function))
-	for i, f := range vm.InnerModule.IndexSpace.Function {
-		if hf, ok := f.(*HostFunction); ok {
-			hf.function = hf.ClosureGenerator(vm)
-			vm.Functions[i] = hf
-		} else {
-			vm.Functions[i] = f
+	vm.Functions = vm.InnerModule.IndexSpace.Function
+	numImported := len(vm.Functions) - len(vm.InnerModule.SecFunctions)
+	for i, f := range vm.Functions {
+		switch f := f.(type) {
+		case *HostFunction:
+			// imported host functions are copied per importing module
+			// so they can be bound to this virtual machine
+			f.function = f.ClosureGenerator(vm)
+		case *NativeFunction:
+			if i >= numImported {
+				f.vm = vm
+			}
 		}
 	}
 
-	// initialize global
-	vm.Globals = make([]uint64, len(vm.InnerModule.IndexSpace.Globals))
-	for i, raw := range vm.InnerModule.IndexSpace.Globals {
-		switch v := raw.Val.(type) {
-		case int32:
-			vm.Globals[i] = uint64(v)
-		case int64:
-			vm.Globals[i] = uint64(v)
-		case float32:
-			vm.Globals[i] = uint64(math.Float32bits(v))
-		case float64:
-			vm.Globals[i] = math.Float64bits(v)
-		}
-	}
+	// globals are shared with the module's index space so that imported
+	// and exported globals are backed by the same cell
+	vm.Globals = vm.InnerModule.IndexSpace.Globals
 
 	// exec start functions
 	for _, id := range vm.InnerModule.SecStart {
 		if int(id) >= len(vm.Functions) {
 			return nil, fmt.Errorf("function index out of range")
 		}
-		vm.Functions[id].Call(vm)
+		if _, err := vm.execFunction(vm.Functions[id], nil); err != nil {
+			return nil, fmt.Errorf("start function: %w", err)
+		}
 	}
 	return vm, nil
 }
 
+// ExecExportedFunction calls the exported function with raw arguments as they are on the operand stack.
+// Use Call for typed arguments and results. If a host function fails, its error is returned as a *HostError.
+// Host functions may call back into the guest with it during their execution.
 func (vm *VirtualMachine) ExecExportedFunction(name string, args ...uint64) (returns []uint64, returnTypes []ValueType, err error) {
-	exp, ok := vm.InnerModule.SecExports[name]
-	if !ok {
-		return nil, nil, fmt.Errorf("exported func of name %s not found", name)
+	f, err := vm.exportedFunction(name)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if exp.Desc.Kind != ExportKindFunction {
-		return nil, nil, fmt.Errorf("exported elent of name %s is not functype", name)
+	if len(f.FunctionType().InputTypes) != len(args) {
+		return nil, nil, fmt.Errorf("invalid number of arguments")
 	}
 
-	if int(exp.Desc.Index) >= len(vm.Functions) {
-		return nil, nil, fmt.Errorf("function index out of range")
+	ret, err := vm.execFunction(f, args)
+	if err != nil {
+		return nil, nil, err
 	}
+	return ret, f.FunctionType().ReturnTypes, nil
+}
 
-	f := vm.Functions[exp.Desc.Index]
-	if len(f.FunctionType().InputTypes) != len(args) {
-		return nil, nil, fmt.Errorf("invalid number of arguments")
+// Call calls the exported function after checking the arguments against its signature.
+func (vm *VirtualMachine) Call(name string, args ...Value) ([]Value, error) {
+	f, err := vm.exportedFunction(name)
+	if err != nil {
+		return nil, err
+	}
+	return vm.call(f, args)
+}
+
+// call calls f after checking the arguments against its signature.
+func (vm *VirtualMachine) call(f VirtualMachineFunction, args []Value) ([]Value, error) {
+	ft := f.FunctionType()
+	if len(ft.InputTypes) != len(args) {
+		return nil, fmt.Errorf("invalid number of arguments: %d != %d", len(args), len(ft.InputTypes))
+	}
+
+	raw := make([]uint64, len(args))
+	for i, arg := range args {
+		if arg.Type() != ft.InputTypes[i] {
+			return nil, fmt.Errorf("type mismatch on argument %d: %#x != %#x", i, arg.Type(), ft.InputTypes[i])
+		}
+		raw[i] = arg.Raw()
+	}
+
+	ret, err := vm.execFunction(f, raw)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]Value, len(ret))
+	for i, r := range ret {
+		values[i] = NewValue(ft.ReturnTypes[i], r)
 	}
+	return values, nil
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// ExportedFunc binds the exported function of the given name to fn, which must be
+// a pointer to a function variable such as `*func(int32, int64) (float64, error)`.
+// The Go signature is checked against the exported function's type once at bind time.
+// The last result may optionally be an error, through which failures of host functions
+// are returned. Without it, such failures panic with the *HostError.
+func (vm *VirtualMachine) ExportedFunc(name string, fn interface{}) error {
+	f, err := vm.exportedFunction(name)
+	if err != nil {
+		return err
+	}
+
+	ptr := reflect.ValueOf(fn)
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Func {
+		return fmt.Errorf("fn must be a pointer to a function but got %T", fn)
+	}
+
+	tp := ptr.Elem().Type()
+	numOut := tp.NumOut()
+	withError := numOut > 0 && tp.Out(numOut-1) == errorType
+	if withError {
+		numOut--
+	}
+
+	sig := f.FunctionType()
+	if tp.NumIn() != len(sig.InputTypes) {
+		return fmt.Errorf("invalid number of parameters: %d != %d", tp.NumIn(), len(sig.InputTypes))
+	} else if numOut != len(sig.ReturnTypes) {
+		return fmt.Errorf("invalid number of results: %d != %d", numOut, len(sig.ReturnTypes))
+	}
+
+	for i, exp := range sig.InputTypes {
+		if vt, err := ValueTypeOf(tp.In(i).Kind()); err != nil {
+			return fmt.Errorf("parameter %d: %w", i, err)
+		} else if vt != exp {
+			return fmt.Errorf("type mismatch on parameter %d: %#x != %#x", i, vt, exp)
+		}
+	}
+
+	for i, exp := range sig.ReturnTypes {
+		if vt, err := ValueTypeOf(tp.Out(i).Kind()); err != nil {
+			return fmt.Errorf("result %d: %w", i, err)
+		} else if vt != exp {
+			return fmt.Errorf("type mismatch on result %d: %#x != %#x", i, vt, exp)
+		}
+	}
+
+	ptr.Elem().Set(reflect.MakeFunc(tp, func(in []reflect.Value) []reflect.Value {
+		args := make([]uint64, len(in))
+		for i, v := range in {
+			switch v.Kind() {
+			case reflect.Float32:
+				args[i] = uint64(math.Float32bits(float32(v.Float())))
+			case reflect.Float64:
+				args[i] = math.Float64bits(v.Float())
+			case reflect.Uint32, reflect.Uint64:
+				args[i] = v.Uint()
+			case reflect.Int32, reflect.Int64:
+				args[i] = uint64(v.Int())
+			}
+		}
+
+		ret, err := vm.execFunction(f, args)
+		out := make([]reflect.Value, tp.NumOut())
+		if err != nil {
+			if !withError {
+				panic(err)
+			}
+			for i := range out {
+				out[i] = reflect.Zero(tp.Out(i))
+			}
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+			return out
+		}
+
+		for i, raw := range ret {
+			v := reflect.New(tp.Out(i)).Elem()
+			switch v.Kind() {
+			case reflect.Float32:
+				v.SetFloat(float64(math.Float32frombits(uint32(raw))))
+			case reflect.Float64:
+				v.SetFloat(math.Float64frombits(raw))
+			case reflect.Uint32:
+				v.SetUint(uint64(uint32(raw)))
+			case reflect.Uint64:
+				v.SetUint(raw)
+			case reflect.Int32:
+				v.SetInt(int64(int32(raw)))
+			case reflect.Int64:
+				v.SetInt(int64(raw))
+			}
+			out[i] = v
+		}
+
+		if withError {
+			out[len(out)-1] = reflect.Zero(errorType)
+		}
+		return out
+	}))
+	return nil
+}
+
+func (vm *VirtualMachine) exportedFunction(name string) (VirtualMachineFunction, error) {
+	idx, err := vm.exportIndex(name, ExportKindFunction)
+	if err != nil {
+		return nil, err
+	}
+
+	if int(idx) >= len(vm.Functions) {
+		return nil, fmt.Errorf("function index out of range")
+	}
+	return vm.Functions[idx], nil
+}
+
+// exportIndex returns the index of the export of the given name, which must be of the given kind.
+func (vm *VirtualMachine) exportIndex(name string, kind byte) (uint32, error) {
+	exp, ok := vm.InnerModule.SecExports[name]
+	if !ok {
+		return 0, fmt.Errorf("export of name %s not found", name)
+	}
+
+	if exp.Desc.Kind != kind {
+		return 0, fmt.Errorf("export of name %s is of kind %#x but want %#x", name, exp.Desc.Kind, kind)
+	}
+	return exp.Desc.Index, nil
+}
+
+// execFunction calls f with args. It is reentrant: host functions may call it while
+// another call is being executed, in which case the nested call runs on top of the
+// current operand stack and ActiveContext is restored afterwards.
+// If the execution is aborted, the state of the virtual machine is restored. Failures of host
+// functions are returned as the error and other panics such as traps are propagated as-is.
+func (vm *VirtualMachine) execFunction(f VirtualMachineFunction, args []uint64) (ret []uint64, err error) {
+	sp, ctx := vm.OperandStack.SP, vm.ActiveContext
+	defer func() {
+		if r := recover(); r != nil {
+			vm.OperandStack.SP, vm.ActiveContext = sp, ctx
+			hostErr, ok := r.(*HostError)
+			if !ok {
+				panic(r)
+			}
+			ret, err = nil, hostErr
+		}
+	}()
 
 	for _, arg := range args {
 		vm.OperandStack.Push(arg)
@@ -110,11 +313,11 @@ func (vm *VirtualMachine) ExecExportedFunction(name string, args ...uint64) (ret
 
 	f.Call(vm)
 
-	ret := make([]uint64, len(f.FunctionType().ReturnTypes))
+	ret = make([]uint64, len(f.FunctionType().ReturnTypes))
 	for i := range ret {
 		ret[len(ret)-1-i] = vm.OperandStack.Pop()
 	}
-	return ret, f.FunctionType().ReturnTypes, nil
+	return ret, nil
 }
 
 func (vm *VirtualMachine) FetchInt32() int32 {
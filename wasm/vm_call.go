@@ -1,5 +1,7 @@
 package wasm
 
+import "fmt"
+
 func call(vm *VirtualMachine) {
 	vm.ActiveContext.PC++
 	index := vm.FetchUint32()
@@ -11,24 +13,65 @@ func callIndirect(vm *VirtualMachine) {
 	index := vm.FetchUint32()
 	expType := vm.InnerModule.SecTypes[index]
 
-	tableIndex := vm.OperandStack.Pop()
+	elemIndex := vm.OperandStack.Pop()
 	// note: mvp limits the size of table index space to 1
-	if tableIndex >= uint64(len(vm.InnerModule.IndexSpace.Table[0])) {
-		panic("table index out of range")
+	f, err := vm.InnerModule.IndexSpace.Table[0].function(elemIndex)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	if err := checkFunctionType(f, expType); err != nil {
+		panic(err.Error())
 	}
+	f.Call(vm)
+
+	vm.ActiveContext.PC++ // skip 0x00
+}
 
-	te := vm.InnerModule.IndexSpace.Table[0][tableIndex]
-	if te == nil {
-		panic("table entry not initialized")
+// Table returns the table exported with the given name.
+func (vm *VirtualMachine) Table(name string) (*Table, error) {
+	idx, err := vm.exportIndex(name, ExportKindTable)
+	if err != nil {
+		return nil, err
 	}
+	return vm.TableByIndex(idx)
+}
 
-	f := vm.Functions[*te]
+// TableByIndex returns the table of the given index in the module's table index space.
+func (vm *VirtualMachine) TableByIndex(index uint32) (*Table, error) {
+	tables := vm.InnerModule.IndexSpace.Table
+	if index >= uint32(len(tables)) {
+		return nil, fmt.Errorf("table index out of range")
+	}
+	return tables[index], nil
+}
+
+// checkFunctionType returns an error unless f has the expected type as call_indirect requires.
+func checkFunctionType(f VirtualMachineFunction, expType *FunctionType) error {
 	ft := f.FunctionType()
 	if !hasSameSignature(ft.InputTypes, expType.InputTypes) ||
 		!hasSameSignature(ft.ReturnTypes, expType.ReturnTypes) {
-		panic("function signature mismatch")
+		return fmt.Errorf("function signature mismatch")
 	}
-	f.Call(vm)
+	return nil
+}
 
-	vm.ActiveContext.PC++ // skip 0x00
+// CallIndirect calls the function at elemIndex of the table of tableIndex like call_indirect,
+// e.g. for callbacks the guest passes to the host as table indexes. As with call_indirect,
+// the function must have the expected type, and the arguments must match it.
+func (vm *VirtualMachine) CallIndirect(expType *FunctionType, tableIndex, elemIndex uint32, args ...Value) ([]Value, error) {
+	table, err := vm.TableByIndex(tableIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := table.function(uint64(elemIndex))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkFunctionType(f, expType); err != nil {
+		return nil, err
+	}
+	return vm.call(f, args)
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type dummyFunc struct {
@@ -36,11 +37,10 @@ func Test_callIndirect(t *testing.T) {
 				Body: []byte{byte(OptCodeCall), 0x01, 0x00},
 			},
 		},
-		Functions: []VirtualMachineFunction{nil, df},
 		InnerModule: &Module{
 			SecTypes: []*FunctionType{nil, {}},
 			IndexSpace: &ModuleIndexSpace{
-				Table: [][]*uint32{{nil, uint32Ptr(1)}},
+				Table: []*Table{{Elements: []VirtualMachineFunction{nil, df}}},
 			},
 		},
 		OperandStack: NewVirtualMachineOperandStack(),
@@ -50,3 +50,74 @@ func Test_callIndirect(t *testing.T) {
 	callIndirect(vm)
 	assert.Equal(t, 1, df.cnt)
 }
+
+func TestVirtualMachine_CallIndirect(t *testing.T) {
+	types := []*FunctionType{
+		{InputTypes: []ValueType{ValueTypeI32}, ReturnTypes: []ValueType{ValueTypeI32}},
+		{ReturnTypes: []ValueType{ValueTypeI64}},
+	}
+	m := &Module{
+		SecTypes:     types,
+		SecFunctions: []uint32{0, 1},
+		SecCodes: []*CodeSegment{
+			{Body: []byte{byte(OptCodeLocalGet), 0x00, byte(OptCodeI32Const), 0x01, byte(OptCodeI32add)}},
+			{Body: []byte{byte(OptCodeI64Const), 0x07}},
+		},
+		SecTables: []*TableType{{Limit: &LimitsType{Min: 3}}},
+		SecElements: []*ElementSegment{
+			{OffsetExpr: &ConstantExpression{data: []byte{byte(OptCodeI32Const), 0x00}}, Init: []uint32{0}},
+		},
+		SecExports: map[string]*ExportSegment{
+			"table":      {Name: "table", Desc: &ExportDesc{Kind: ExportKindTable, Index: 0}},
+			"seven":      {Name: "seven", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 1}},
+			"not_table":  {Name: "not_table", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 0}},
+			"out_of_idx": {Name: "out_of_idx", Desc: &ExportDesc{Kind: ExportKindTable, Index: 1}},
+		},
+	}
+	vm, err := NewVM(m, nil)
+	require.NoError(t, err)
+
+	table, err := vm.Table("table")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), table.Size())
+	for _, name := range []string{"not_table", "out_of_idx", "unknown"} {
+		_, err = vm.Table(name)
+		assert.Error(t, err)
+	}
+
+	ret, err := vm.CallIndirect(types[0], 0, 0, I32(41))
+	require.NoError(t, err)
+	assert.Equal(t, []Value{I32(42)}, ret)
+
+	// the host puts an exported function into the table
+	seven, err := vm.exportedFunction("seven")
+	require.NoError(t, err)
+	require.True(t, table.Set(2, seven))
+	ret, err = vm.CallIndirect(types[1], 0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []Value{I64(7)}, ret)
+
+	for _, c := range []struct {
+		expType               *FunctionType
+		tableIndex, elemIndex uint32
+		args                  []Value
+		expErr                string
+	}{
+		{expType: types[0], tableIndex: 1, args: []Value{I32(1)}, expErr: "table index out of range"},
+		{expType: types[0], elemIndex: 3, args: []Value{I32(1)}, expErr: "table index out of range"},
+		{expType: types[0], elemIndex: 1, args: []Value{I32(1)}, expErr: "table entry not initialized"},
+		// the function doesn't have the expected type even if the arguments match it
+		{expType: types[1], elemIndex: 0, args: []Value{I32(1)}, expErr: "function signature mismatch"},
+		{expType: &FunctionType{InputTypes: []ValueType{ValueTypeI32}}, elemIndex: 0, args: []Value{I32(1)}, expErr: "function signature mismatch"},
+		// the arguments don't match the type
+		{expType: types[0], elemIndex: 0, args: []Value{I64(1)}},
+		{expType: types[0], elemIndex: 0},
+	} {
+		_, err := vm.CallIndirect(c.expType, c.tableIndex, c.elemIndex, c.args...)
+		require.Error(t, err)
+		if c.expErr != "" {
+			assert.Equal(t, c.expErr, err.Error())
+		}
+	}
+	assert.Equal(t, -1, vm.OperandStack.SP)
+}
@@ -1,8 +1,10 @@
 package wasm
 
 import (
+	"fmt"
 	"math"
 	"reflect"
+	"strings"
 )
 
 type (
@@ -15,11 +17,29 @@ type (
 		function         reflect.Value // should be set at the time of VM creation
 		Signature        *FunctionType
 	}
+	// RawHostFunction is a host function which receives its parameters and writes its results
+	// as raw values as they are on the operand stack, without going through reflection.
+	// params is only valid during the call. A non-nil error aborts the execution and is
+	// returned as a *HostError.
+	RawHostFunction struct {
+		Signature *FunctionType
+		Function  func(vm *VirtualMachine, params []uint64, results []uint64) error
+	}
 	NativeFunction struct {
 		Signature *FunctionType
 		NumLocal  uint32
 		Body      []byte
 		Blocks    map[uint64]*NativeFunctionBlock
+
+		// vm is the instance which defines this function
+		vm *VirtualMachine
+	}
+	// HostError is the error returned when a host function fails and aborts the guest execution.
+	HostError struct {
+		Err error
+		// Backtrace holds the indexes of the native functions on the call stack
+		// at the time of the failure, innermost first.
+		Backtrace []uint32
 	}
 	NativeFunctionBlock struct {
 		StartAt, ElseAt, EndAt uint64
@@ -30,13 +50,48 @@ type (
 
 var (
 	_ VirtualMachineFunction = &HostFunction{}
+	_ VirtualMachineFunction = &RawHostFunction{}
 	_ VirtualMachineFunction = &NativeFunction{}
 )
 
+func (e *HostError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "host function failed: %v", e.Err)
+	if len(e.Backtrace) > 0 {
+		b.WriteString("\nwasm backtrace:")
+		for i, idx := range e.Backtrace {
+			fmt.Fprintf(&b, "\n\t%d: $%d", i, idx)
+		}
+	}
+	return b.String()
+}
+
+func (e *HostError) Unwrap() error {
+	return e.Err
+}
+
+// newHostError wraps err with the backtrace of the native functions being executed.
+func (vm *VirtualMachine) newHostError(err error) *HostError {
+	e := &HostError{Err: err}
+	for ctx := vm.ActiveContext; ctx != nil; ctx = ctx.caller {
+		for i, f := range vm.Functions {
+			if f == ctx.Function {
+				e.Backtrace = append(e.Backtrace, uint32(i))
+				break
+			}
+		}
+	}
+	return e
+}
+
 func (h *HostFunction) FunctionType() *FunctionType {
 	return h.Signature
 }
 
+func (r *RawHostFunction) FunctionType() *FunctionType {
+	return r.Signature
+}
+
 func (n *NativeFunction) FunctionType() *FunctionType {
 	return n.Signature
 }
@@ -50,7 +105,9 @@ func (h *HostFunction) Call(vm *VirtualMachine) {
 		kind := tp.In(i).Kind()
 
 		switch kind {
-		case reflect.Float64, reflect.Float32:
+		case reflect.Float32:
+			val.SetFloat(float64(math.Float32frombits(uint32(raw))))
+		case reflect.Float64:
 			val.SetFloat(math.Float64frombits(raw))
 		case reflect.Uint32, reflect.Uint64:
 			val.SetUint(raw)
@@ -62,9 +119,20 @@ func (h *HostFunction) Call(vm *VirtualMachine) {
 		in[i] = val
 	}
 
-	for _, ret := range h.function.Call(in) {
+	out := h.function.Call(in)
+	if len(out) > len(h.Signature.ReturnTypes) {
+		// the last result is an error which is not visible to wasm
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			panic(vm.newHostError(err))
+		}
+		out = out[:len(out)-1]
+	}
+
+	for _, ret := range out {
 		switch ret.Kind() {
-		case reflect.Float64, reflect.Float32:
+		case reflect.Float32:
+			vm.OperandStack.Push(uint64(math.Float32bits(float32(ret.Float()))))
+		case reflect.Float64:
 			vm.OperandStack.Push(math.Float64bits(ret.Float()))
 		case reflect.Uint32, reflect.Uint64:
 			vm.OperandStack.Push(ret.Uint())
@@ -76,7 +144,45 @@ func (h *HostFunction) Call(vm *VirtualMachine) {
 	}
 }
 
+func (r *RawHostFunction) Call(vm *VirtualMachine) {
+	s := vm.OperandStack
+	np := len(r.Signature.InputTypes)
+	// the parameters are passed in place; they stay below the stack pointer
+	// until the call returns so nested calls into the guest don't overwrite them
+	params := s.Stack[s.SP-np+1 : s.SP+1]
+
+	var results []uint64
+	if nr := len(r.Signature.ReturnTypes); nr > 0 {
+		results = make([]uint64, nr)
+	}
+
+	if err := r.Function(vm, params, results); err != nil {
+		panic(vm.newHostError(err))
+	}
+
+	s.SP -= np
+	for _, v := range results {
+		s.Push(v)
+	}
+}
+
 func (n *NativeFunction) Call(vm *VirtualMachine) {
+	if n.vm != nil && n.vm != vm {
+		// the function is imported from another instance,
+		// so it must be executed against the callee's state
+		callee := n.vm
+		// restore the callee's state even if the execution is aborted
+		sp, ctx := callee.OperandStack.SP, callee.ActiveContext
+		defer func() {
+			callee.OperandStack.SP, callee.ActiveContext = sp, ctx
+		}()
+
+		vm.OperandStack.moveTo(callee.OperandStack, len(n.Signature.InputTypes))
+		n.Call(callee)
+		callee.OperandStack.moveTo(vm.OperandStack, len(n.Signature.ReturnTypes))
+		return
+	}
+
 	al := len(n.Signature.InputTypes)
 	locals := make([]uint64, n.NumLocal+uint32(al))
 	for i := 0; i < al; i++ {
@@ -88,6 +194,7 @@ func (n *NativeFunction) Call(vm *VirtualMachine) {
 		Function:   n,
 		Locals:     locals,
 		LabelStack: NewVirtualMachineLabelStack(),
+		caller:     prev,
 	}
 	vm.execNativeFunction()
 	vm.ActiveContext = prev
@@ -1,11 +1,13 @@
 package wasm
 
 import (
+	"errors"
 	"math"
 	"reflect"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHostFunction_Call(t *testing.T) {
@@ -31,11 +33,79 @@ func TestHostFunction_Call(t *testing.T) {
 
 	// f64
 	assert.Equal(t, 4.0, math.Float64frombits(vm.OperandStack.Pop()))
-	assert.Equal(t, float32(3.0), float32(math.Float64frombits(vm.OperandStack.Pop())))
+	assert.Equal(t, float32(3.0), math.Float32frombits(uint32(vm.OperandStack.Pop())))
 	assert.Equal(t, int64(2), int64(vm.OperandStack.Pop()))
 	assert.Equal(t, int32(1), int32(vm.OperandStack.Pop()))
 }
 
+func TestHostError(t *testing.T) {
+	errDenied := errors.New("permission denied")
+	sig := &FunctionType{InputTypes: []ValueType{ValueTypeI32}, ReturnTypes: []ValueType{ValueTypeI32}}
+	externModules := map[string]*Module{
+		"env": {
+			SecExports: map[string]*ExportSegment{
+				"check": {Name: "check", Desc: &ExportDesc{Kind: ExportKindFunction}},
+			},
+			IndexSpace: &ModuleIndexSpace{Function: []VirtualMachineFunction{&HostFunction{
+				ClosureGenerator: func(*VirtualMachine) reflect.Value {
+					return reflect.ValueOf(func(x int32) (int32, error) {
+						if x != 0 {
+							return 0, errDenied
+						}
+						return 42, nil
+					})
+				},
+				Signature: sig,
+			}}},
+		},
+	}
+
+	m := &Module{
+		SecTypes: []*FunctionType{sig},
+		SecImports: []*ImportSegment{
+			{Module: "env", Name: "check", Desc: &ImportDesc{Kind: ExportKindFunction, TypeIndexPtr: uint32Ptr(0)}},
+		},
+		SecFunctions: []uint32{0, 0},
+		SecCodes: []*CodeSegment{
+			{Body: []byte{byte(OptCodeLocalGet), 0x00, byte(OptCodeCall), 0x00}},
+			{Body: []byte{byte(OptCodeLocalGet), 0x00, byte(OptCodeCall), 0x01}},
+		},
+		SecExports: map[string]*ExportSegment{
+			"run": {Name: "run", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 2}},
+		},
+	}
+	vm, err := NewVM(m, externModules)
+	require.NoError(t, err)
+
+	ret, _, err := vm.ExecExportedFunction("run", 0)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{42}, ret)
+
+	_, _, err = vm.ExecExportedFunction("run", 1)
+	require.True(t, errors.Is(err, errDenied))
+	var hostErr *HostError
+	require.True(t, errors.As(err, &hostErr))
+	assert.Equal(t, []uint32{1, 2}, hostErr.Backtrace)
+	assert.Equal(t, -1, vm.OperandStack.SP)
+	assert.Nil(t, vm.ActiveContext)
+
+	_, err = vm.Call("run", I32(1))
+	require.True(t, errors.Is(err, errDenied))
+
+	var withErr func(int32) (int32, error)
+	require.NoError(t, vm.ExportedFunc("run", &withErr))
+	_, err = withErr(1)
+	require.True(t, errors.Is(err, errDenied))
+	actual, err := withErr(0)
+	require.NoError(t, err)
+	require.Equal(t, int32(42), actual)
+
+	var withoutErr func(int32) int32
+	require.NoError(t, vm.ExportedFunc("run", &withoutErr))
+	require.Panics(t, func() { withoutErr(1) })
+	require.Equal(t, int32(42), withoutErr(0))
+}
+
 func TestNativeFunction_Call(t *testing.T) {
 	n := &NativeFunction{
 		Signature: &FunctionType{},
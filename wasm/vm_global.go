@@ -1,13 +1,45 @@
 package wasm
 
+import "fmt"
+
+// Global returns the global exported with the given name.
+func (vm *VirtualMachine) Global(name string) (*Global, error) {
+	idx, err := vm.exportIndex(name, ExportKindGlobal)
+	if err != nil {
+		return nil, err
+	}
+
+	if int(idx) >= len(vm.Globals) {
+		return nil, fmt.Errorf("global index out of range")
+	}
+	return vm.Globals[idx], nil
+}
+
+// Get returns the current value of the global.
+func (g *Global) Get() Value {
+	return NewValue(g.Type.Value, g.Val)
+}
+
+// Set sets the value of the global. It fails if the global is immutable
+// or the type of v doesn't match the one of the global.
+func (g *Global) Set(v Value) error {
+	if !g.Type.Mutable {
+		return fmt.Errorf("global is immutable")
+	} else if v.Type() != g.Type.Value {
+		return fmt.Errorf("type mismatch: %#x != %#x", v.Type(), g.Type.Value)
+	}
+	g.Val = v.Raw()
+	return nil
+}
+
 func getGlobal(vm *VirtualMachine) {
 	vm.ActiveContext.PC++
 	id := vm.FetchUint32()
-	vm.OperandStack.Push(vm.Globals[id])
+	vm.OperandStack.Push(vm.Globals[id].Val)
 }
 
 func setGlobal(vm *VirtualMachine) {
 	vm.ActiveContext.PC++
 	id := vm.FetchUint32()
-	vm.Globals[id] = vm.OperandStack.Pop()
+	vm.Globals[id].Val = vm.OperandStack.Pop()
 }
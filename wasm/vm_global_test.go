@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_getGlobal(t *testing.T) {
@@ -14,7 +15,7 @@ func Test_getGlobal(t *testing.T) {
 	}
 
 	exp := uint64(1)
-	globals := []uint64{0, 0, 0, 0, 0, exp}
+	globals := []*Global{{}, {}, {}, {}, {}, {Val: exp}}
 
 	vm := &VirtualMachine{
 		ActiveContext: ctx,
@@ -37,8 +38,55 @@ func Test_setGlobal(t *testing.T) {
 	st := NewVirtualMachineOperandStack()
 	st.Push(exp)
 
-	vm := &VirtualMachine{ActiveContext: ctx, OperandStack: st, Globals: []uint64{0, 0, 0, 0, 0, 0}}
+	vm := &VirtualMachine{ActiveContext: ctx, OperandStack: st, Globals: []*Global{{}, {}, {}, {}, {}, {}}}
 	setGlobal(vm)
-	assert.Equal(t, exp, vm.Globals[5])
+	assert.Equal(t, exp, vm.Globals[5].Val)
 	assert.Equal(t, -1, vm.OperandStack.SP)
 }
+
+func TestVirtualMachine_Global(t *testing.T) {
+	m := &Module{
+		SecTypes:     []*FunctionType{{ReturnTypes: []ValueType{ValueTypeI32}}},
+		SecFunctions: []uint32{0},
+		SecCodes:     []*CodeSegment{{Body: []byte{byte(OptCodeGlobalGet), 0x01}}},
+		SecGlobals: []*GlobalSegment{
+			{
+				Type: &GlobalType{Value: ValueTypeF64},
+				Init: &ConstantExpression{data: []byte{byte(OptCodeF64Const), 0, 0, 0, 0, 0, 0, 0xf8, 0x3f}},
+			},
+			{
+				Type: &GlobalType{Value: ValueTypeI32, Mutable: true},
+				Init: &ConstantExpression{data: []byte{byte(OptCodeI32Const), 0x00}},
+			},
+		},
+		SecExports: map[string]*ExportSegment{
+			"config": {Name: "config", Desc: &ExportDesc{Kind: ExportKindGlobal, Index: 0}},
+			"flag":   {Name: "flag", Desc: &ExportDesc{Kind: ExportKindGlobal, Index: 1}},
+			"get":    {Name: "get", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 0}},
+		},
+	}
+	vm, err := NewVM(m, nil)
+	require.NoError(t, err)
+
+	config, err := vm.Global("config")
+	require.NoError(t, err)
+	assert.Equal(t, F64(1.5), config.Get())
+	assert.Error(t, config.Set(F64(2)))
+	assert.Equal(t, F64(1.5), config.Get())
+
+	flag, err := vm.Global("flag")
+	require.NoError(t, err)
+	assert.Error(t, flag.Set(I64(1)))
+	require.NoError(t, flag.Set(I32(-1)))
+	assert.Equal(t, I32(-1), flag.Get())
+
+	// the guest observes the value set by the host
+	ret, err := vm.Call("get")
+	require.NoError(t, err)
+	assert.Equal(t, []Value{I32(-1)}, ret)
+
+	_, err = vm.Global("get")
+	assert.Error(t, err)
+	_, err = vm.Global("unknown")
+	assert.Error(t, err)
+}
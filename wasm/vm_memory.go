@@ -13,12 +13,12 @@ func memoryBase(vm *VirtualMachine) uint64 {
 
 func i32Load(vm *VirtualMachine) {
 	base := memoryBase(vm)
-	vm.OperandStack.Push(uint64(binary.LittleEndian.Uint32(vm.Memory[base:])))
+	vm.OperandStack.Push(uint64(binary.LittleEndian.Uint32(vm.Memory.Buffer[base:])))
 }
 
 func i64Load(vm *VirtualMachine) {
 	base := memoryBase(vm)
-	vm.OperandStack.Push(binary.LittleEndian.Uint64(vm.Memory[base:]))
+	vm.OperandStack.Push(binary.LittleEndian.Uint64(vm.Memory.Buffer[base:]))
 }
 
 func f32Load(vm *VirtualMachine) {
@@ -31,7 +31,7 @@ func f64Load(vm *VirtualMachine) {
 
 func i32Load8s(vm *VirtualMachine) {
 	base := memoryBase(vm)
-	vm.OperandStack.Push(uint64(vm.Memory[base]))
+	vm.OperandStack.Push(uint64(vm.Memory.Buffer[base]))
 }
 
 func i32Load8u(vm *VirtualMachine) {
@@ -40,7 +40,7 @@ func i32Load8u(vm *VirtualMachine) {
 
 func i32Load16s(vm *VirtualMachine) {
 	base := memoryBase(vm)
-	vm.OperandStack.Push(uint64(binary.LittleEndian.Uint16(vm.Memory[base:])))
+	vm.OperandStack.Push(uint64(binary.LittleEndian.Uint16(vm.Memory.Buffer[base:])))
 }
 
 func i32Load16u(vm *VirtualMachine) {
@@ -49,7 +49,7 @@ func i32Load16u(vm *VirtualMachine) {
 
 func i64Load8s(vm *VirtualMachine) {
 	base := memoryBase(vm)
-	vm.OperandStack.Push(uint64(vm.Memory[base]))
+	vm.OperandStack.Push(uint64(vm.Memory.Buffer[base]))
 }
 
 func i64Load8u(vm *VirtualMachine) {
@@ -58,7 +58,7 @@ func i64Load8u(vm *VirtualMachine) {
 
 func i64Load16s(vm *VirtualMachine) {
 	base := memoryBase(vm)
-	vm.OperandStack.Push(uint64(binary.LittleEndian.Uint16(vm.Memory[base:])))
+	vm.OperandStack.Push(uint64(binary.LittleEndian.Uint16(vm.Memory.Buffer[base:])))
 }
 
 func i64Load16u(vm *VirtualMachine) {
@@ -67,7 +67,7 @@ func i64Load16u(vm *VirtualMachine) {
 
 func i64Load32s(vm *VirtualMachine) {
 	base := memoryBase(vm)
-	vm.OperandStack.Push(uint64(binary.LittleEndian.Uint32(vm.Memory[base:])))
+	vm.OperandStack.Push(uint64(binary.LittleEndian.Uint32(vm.Memory.Buffer[base:])))
 }
 
 func i64Load32u(vm *VirtualMachine) {
@@ -77,73 +77,71 @@ func i64Load32u(vm *VirtualMachine) {
 func i32Store(vm *VirtualMachine) {
 	val := vm.OperandStack.Pop()
 	base := memoryBase(vm)
-	binary.LittleEndian.PutUint32(vm.Memory[base:], uint32(val))
+	binary.LittleEndian.PutUint32(vm.Memory.Buffer[base:], uint32(val))
 }
 
 func i64Store(vm *VirtualMachine) {
 	val := vm.OperandStack.Pop()
 	base := memoryBase(vm)
-	binary.LittleEndian.PutUint64(vm.Memory[base:], val)
+	binary.LittleEndian.PutUint64(vm.Memory.Buffer[base:], val)
 }
 
 func f32Store(vm *VirtualMachine) {
 	val := vm.OperandStack.Pop()
 	base := memoryBase(vm)
-	binary.LittleEndian.PutUint32(vm.Memory[base:], uint32(val))
+	binary.LittleEndian.PutUint32(vm.Memory.Buffer[base:], uint32(val))
 }
 
 func f64Store(vm *VirtualMachine) {
 	v := vm.OperandStack.Pop()
 	base := memoryBase(vm)
-	binary.LittleEndian.PutUint64(vm.Memory[base:], v)
+	binary.LittleEndian.PutUint64(vm.Memory.Buffer[base:], v)
 }
 
 func i32Store8(vm *VirtualMachine) {
 	v := byte(vm.OperandStack.Pop())
 	base := memoryBase(vm)
-	vm.Memory[base] = v
+	vm.Memory.Buffer[base] = v
 }
 
 func i32Store16(vm *VirtualMachine) {
 	v := uint16(vm.OperandStack.Pop())
 	base := memoryBase(vm)
-	binary.LittleEndian.PutUint16(vm.Memory[base:], v)
+	binary.LittleEndian.PutUint16(vm.Memory.Buffer[base:], v)
 }
 
 func i64Store8(vm *VirtualMachine) {
 	v := byte(vm.OperandStack.Pop())
 	base := memoryBase(vm)
-	vm.Memory[base] = v
+	vm.Memory.Buffer[base] = v
 }
 
 func i64Store16(vm *VirtualMachine) {
 	v := uint16(vm.OperandStack.Pop())
 	base := memoryBase(vm)
-	binary.LittleEndian.PutUint16(vm.Memory[base:], v)
+	binary.LittleEndian.PutUint16(vm.Memory.Buffer[base:], v)
 }
 
 func i64Store32(vm *VirtualMachine) {
 	v := uint32(vm.OperandStack.Pop())
 	base := memoryBase(vm)
-	binary.LittleEndian.PutUint32(vm.Memory[base:], v)
+	binary.LittleEndian.PutUint32(vm.Memory.Buffer[base:], v)
 }
 
 func memorySize(vm *VirtualMachine) {
 	vm.ActiveContext.PC++
-	vm.OperandStack.Push(uint64(int32(len(vm.Memory) / vmPageSize)))
+	vm.OperandStack.Push(uint64(vm.Memory.Size()))
 }
 
 func memoryGrow(vm *VirtualMachine) {
 	vm.ActiveContext.PC++
 	n := uint32(vm.OperandStack.Pop())
 
-	if vm.InnerModule.SecMemory[0].Max != nil &&
-		uint64(n+uint32(len(vm.Memory)/vmPageSize)) > uint64(*(vm.InnerModule.SecMemory[0].Max)) {
+	prev, ok := vm.Memory.Grow(n)
+	if !ok {
 		v := int32(-1)
 		vm.OperandStack.Push(uint64(v))
 		return
 	}
-
-	vm.OperandStack.Push(uint64(len(vm.Memory)) / vmPageSize)
-	vm.Memory = append(vm.Memory, make([]byte, n*vmPageSize)...)
+	vm.OperandStack.Push(uint64(prev))
 }
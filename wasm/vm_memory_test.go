@@ -14,7 +14,7 @@ func Test_i32Load(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Load), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x01, 0x00, 0x00, 0x00},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x01, 0x00, 0x00, 0x00}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
@@ -30,7 +30,7 @@ func Test_i64Load(t *testing.T) {
 				Body: []byte{byte(OptCodeI64Load), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
@@ -46,7 +46,7 @@ func Test_f32Load(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Load), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x01, 0x00, 0x00, 0x00},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x01, 0x00, 0x00, 0x00}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
@@ -63,7 +63,7 @@ func Test_f64Load(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Load), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x00},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x00}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
@@ -80,7 +80,7 @@ func Test_i32Load8s(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Load), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0xff},
+		Memory:       &Memory{Buffer: []byte{0x00, 0xff}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
@@ -96,7 +96,7 @@ func Test_i32Load8u(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Load), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0xff},
+		Memory:       &Memory{Buffer: []byte{0x00, 0xff}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
@@ -112,7 +112,7 @@ func Test_i32Load16s(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Load), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0xff, 0x01},
+		Memory:       &Memory{Buffer: []byte{0x00, 0xff, 0x01}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
@@ -128,7 +128,7 @@ func Test_i32Load16u(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Load), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x00, 0xff},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x00, 0xff}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
@@ -144,7 +144,7 @@ func Test_i64Load8s(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Load), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0xff},
+		Memory:       &Memory{Buffer: []byte{0x00, 0xff}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
@@ -160,7 +160,7 @@ func Test_i64Load8u(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Load), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0xff},
+		Memory:       &Memory{Buffer: []byte{0x00, 0xff}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
@@ -176,7 +176,7 @@ func Test_i64Load16s(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Load), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0xff, 0x01},
+		Memory:       &Memory{Buffer: []byte{0x00, 0xff, 0x01}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
@@ -192,7 +192,7 @@ func Test_i64Load16u(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Load), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x00, 0xff},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x00, 0xff}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
@@ -208,7 +208,7 @@ func Test_i64Load32s(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Load), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0xff, 0x01, 0x00, 0x01},
+		Memory:       &Memory{Buffer: []byte{0x00, 0xff, 0x01, 0x00, 0x01}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
@@ -224,7 +224,7 @@ func Test_i64Load32u(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Load), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x00, 0xff, 0x00, 0xff},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x00, 0xff, 0x00, 0xff}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
@@ -240,14 +240,14 @@ func Test_i32Store(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Store), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
 	vm.OperandStack.Push(uint64(1))
 	vm.OperandStack.Push(uint64(0xffffff11))
 	i32Store(vm)
-	assert.Equal(t, []byte{0x11, 0xff, 0xff, 0xff}, vm.Memory[2:])
+	assert.Equal(t, []byte{0x11, 0xff, 0xff, 0xff}, vm.Memory.Buffer[2:])
 }
 
 func Test_i64Store(t *testing.T) {
@@ -257,7 +257,7 @@ func Test_i64Store(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Store), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
@@ -269,7 +269,7 @@ func Test_i64Store(t *testing.T) {
 			0x22, 0x22, 0x22, 0x22,
 			0x11, 0xff, 0xff, 0xff,
 		},
-		vm.Memory[2:],
+		vm.Memory.Buffer[2:],
 	)
 }
 
@@ -280,14 +280,14 @@ func Test_f32Store(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Store), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
 	vm.OperandStack.Push(uint64(1))
 	vm.OperandStack.Push(uint64(math.Float32bits(math.Float32frombits(0xffff_1111))))
 	f32Store(vm)
-	assert.Equal(t, []byte{0x11, 0x11, 0xff, 0xff}, vm.Memory[2:])
+	assert.Equal(t, []byte{0x11, 0x11, 0xff, 0xff}, vm.Memory.Buffer[2:])
 }
 
 func Test_f64Store(t *testing.T) {
@@ -297,14 +297,14 @@ func Test_f64Store(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Store), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
 	vm.OperandStack.Push(uint64(1))
 	vm.OperandStack.Push(math.Float64bits(math.Float64frombits(0xffff_1111_0000_1111)))
 	f64Store(vm)
-	assert.Equal(t, []byte{0x11, 0x11, 0x00, 0x00, 0x11, 0x11, 0xff, 0xff}, vm.Memory[2:])
+	assert.Equal(t, []byte{0x11, 0x11, 0x00, 0x00, 0x11, 0x11, 0xff, 0xff}, vm.Memory.Buffer[2:])
 }
 
 func Test_i32store8(t *testing.T) {
@@ -314,14 +314,14 @@ func Test_i32store8(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Store), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x00, 0x00},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x00, 0x00}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
 	vm.OperandStack.Push(uint64(1))
 	vm.OperandStack.Push(uint64(byte(111)))
 	i32Store8(vm)
-	assert.Equal(t, byte(111), vm.Memory[2])
+	assert.Equal(t, byte(111), vm.Memory.Buffer[2])
 }
 
 func Test_i32store16(t *testing.T) {
@@ -331,14 +331,14 @@ func Test_i32store16(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Store), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x00, 0x00, 0x00},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x00, 0x00, 0x00}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
 	vm.OperandStack.Push(uint64(1))
 	vm.OperandStack.Push(uint64(uint16(0x11ff)))
 	i32Store16(vm)
-	assert.Equal(t, []byte{0xff, 0x11}, vm.Memory[2:])
+	assert.Equal(t, []byte{0xff, 0x11}, vm.Memory.Buffer[2:])
 }
 
 func Test_i64store8(t *testing.T) {
@@ -348,14 +348,14 @@ func Test_i64store8(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Store), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x00, 0x00},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x00, 0x00}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
 	vm.OperandStack.Push(uint64(1))
 	vm.OperandStack.Push(uint64(byte(111)))
 	i64Store8(vm)
-	assert.Equal(t, byte(111), vm.Memory[2])
+	assert.Equal(t, byte(111), vm.Memory.Buffer[2])
 }
 
 func Test_i64store16(t *testing.T) {
@@ -365,14 +365,14 @@ func Test_i64store16(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Store), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x00, 0x00, 0x00},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x00, 0x00, 0x00}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
 	vm.OperandStack.Push(uint64(1))
 	vm.OperandStack.Push(uint64(uint16(0x11ff)))
 	i64Store16(vm)
-	assert.Equal(t, []byte{0xff, 0x11}, vm.Memory[2:])
+	assert.Equal(t, []byte{0xff, 0x11}, vm.Memory.Buffer[2:])
 }
 
 func Test_i64store32(t *testing.T) {
@@ -382,20 +382,20 @@ func Test_i64store32(t *testing.T) {
 				Body: []byte{byte(OptCodeI32Store), 0x00, 0x01},
 			},
 		},
-		Memory:       []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		Memory:       &Memory{Buffer: []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
 		OperandStack: NewVirtualMachineOperandStack(),
 	}
 
 	vm.OperandStack.Push(uint64(1))
 	vm.OperandStack.Push(uint64(uint32(0x11ff_22ee)))
 	i64Store32(vm)
-	assert.Equal(t, []byte{0xee, 0x22, 0xff, 0x11}, vm.Memory[2:])
+	assert.Equal(t, []byte{0xee, 0x22, 0xff, 0x11}, vm.Memory.Buffer[2:])
 }
 
 func Test_memorySize(t *testing.T) {
 	vm := &VirtualMachine{
 		ActiveContext: &NativeFunctionContext{},
-		Memory:        make([]byte, vmPageSize*2),
+		Memory:        &Memory{Buffer: make([]byte, vmPageSize*2)},
 		OperandStack:  NewVirtualMachineOperandStack(),
 	}
 
@@ -407,33 +407,28 @@ func Test_memoryGrow(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
 		vm := &VirtualMachine{
 			ActiveContext: &NativeFunctionContext{},
-			Memory:        make([]byte, vmPageSize*2),
+			Memory:        &Memory{Buffer: make([]byte, vmPageSize*2)},
 			OperandStack:  NewVirtualMachineOperandStack(),
-			InnerModule: &Module{
-				SecMemory: []*MemoryType{{}},
-			},
 		}
 
 		vm.OperandStack.Push(5)
 		memoryGrow(vm)
 		assert.Equal(t, uint64(0x2), vm.OperandStack.Pop())
-		assert.Equal(t, 7, len(vm.Memory)/vmPageSize)
+		assert.Equal(t, 7, len(vm.Memory.Buffer)/vmPageSize)
 	})
 
 	t.Run("oom", func(t *testing.T) {
 		vm := &VirtualMachine{
 			ActiveContext: &NativeFunctionContext{},
-			Memory:        make([]byte, vmPageSize*2),
+			Memory:        &Memory{Buffer: make([]byte, vmPageSize*2), Max: uint32Ptr(6)},
 			OperandStack:  NewVirtualMachineOperandStack(),
-			InnerModule: &Module{
-				SecMemory: []*MemoryType{{Max: uint32Ptr(0)}},
-			},
 		}
 
 		exp := int32(-1)
 		vm.OperandStack.Push(5)
 		memoryGrow(vm)
 		assert.Equal(t, uint64(exp), vm.OperandStack.Pop())
+		assert.Equal(t, 2, len(vm.Memory.Buffer)/vmPageSize)
 	})
 
 }
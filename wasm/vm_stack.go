@@ -54,6 +54,14 @@ func (s *VirtualMachineOperandStack) Push(val uint64) {
 	s.SP++
 }
 
+// moveTo pops the top n values and pushes them onto dst keeping their order.
+func (s *VirtualMachineOperandStack) moveTo(dst *VirtualMachineOperandStack, n int) {
+	for _, v := range s.Stack[s.SP-n+1 : s.SP+1] {
+		dst.Push(v)
+	}
+	s.SP -= n
+}
+
 func (s *VirtualMachineOperandStack) PushBool(b bool) {
 	if b {
 		s.Push(1)
@@ -1,9 +1,11 @@
 package wasm
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -43,6 +45,200 @@ func TestVirtualMachine_ExecExportedFunction(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestVirtualMachine_ExecExportedFunction_reentrant(t *testing.T) {
+	const depth = 3
+	var trapAt, failAt int32 = -1, -1
+	errFailed := errors.New("failed")
+
+	// host(x) calls back into run(x+1) until the depth is reached, and then leaf(x)
+	host := func(vm *VirtualMachine) reflect.Value {
+		return reflect.ValueOf(func(x int32) (int32, error) {
+			sp, ctx := vm.OperandStack.SP, vm.ActiveContext
+			defer func() {
+				assert.Equal(t, sp, vm.OperandStack.SP)
+				assert.Equal(t, ctx, vm.ActiveContext)
+			}()
+
+			switch x {
+			case trapAt:
+				_, _, err := vm.ExecExportedFunction("trap")
+				return 0, err
+			case failAt:
+				return 0, errFailed
+			case depth:
+				ret, _, err := vm.ExecExportedFunction("leaf", uint64(x))
+				if err != nil {
+					return 0, err
+				}
+				return int32(ret[0]), nil
+			}
+
+			ret, _, err := vm.ExecExportedFunction("run", uint64(x+1))
+			if err != nil {
+				return 0, err
+			}
+			return int32(ret[0]) + 10, nil
+		})
+	}
+
+	sig := &FunctionType{InputTypes: []ValueType{ValueTypeI32}, ReturnTypes: []ValueType{ValueTypeI32}}
+	externModules := map[string]*Module{
+		"env": {
+			SecExports: map[string]*ExportSegment{
+				"host": {Name: "host", Desc: &ExportDesc{Kind: ExportKindFunction}},
+			},
+			IndexSpace: &ModuleIndexSpace{Function: []VirtualMachineFunction{
+				&HostFunction{ClosureGenerator: host, Signature: sig},
+			}},
+		},
+	}
+	m := &Module{
+		SecTypes: []*FunctionType{sig, {}},
+		SecImports: []*ImportSegment{
+			{Module: "env", Name: "host", Desc: &ImportDesc{Kind: ExportKindFunction, TypeIndexPtr: uint32Ptr(0)}},
+		},
+		SecFunctions: []uint32{0, 0, 1},
+		SecCodes: []*CodeSegment{
+			// run(x) = 5 + host(x) keeps a value on the operand stack during the host call
+			{Body: []byte{
+				byte(OptCodeI32Const), 0x05, byte(OptCodeLocalGet), 0x00, byte(OptCodeCall), 0x00, byte(OptCodeI32add),
+			}},
+			// leaf(x) = x + 1
+			{Body: []byte{byte(OptCodeLocalGet), 0x00, byte(OptCodeI32Const), 0x01, byte(OptCodeI32add)}},
+			{Body: []byte{byte(OptCodeUnreachable)}},
+		},
+		SecExports: map[string]*ExportSegment{
+			"run":  {Name: "run", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 1}},
+			"leaf": {Name: "leaf", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 2}},
+			"trap": {Name: "trap", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 3}},
+		},
+	}
+	vm, err := NewVM(m, externModules)
+	require.NoError(t, err)
+
+	requireRun := func() {
+		ret, _, err := vm.ExecExportedFunction("run", 0)
+		require.NoError(t, err)
+		// run(3) = 5 + leaf(3), and each level above adds 5 + 10
+		require.Equal(t, []uint64{9 + 15*depth}, ret)
+		require.Equal(t, -1, vm.OperandStack.SP)
+		require.Nil(t, vm.ActiveContext)
+	}
+	requireRun()
+
+	t.Run("trap", func(t *testing.T) {
+		trapAt = 2
+		require.PanicsWithValue(t, "unreachable", func() {
+			_, _, _ = vm.ExecExportedFunction("run", 0)
+		})
+		trapAt = -1
+		require.Equal(t, -1, vm.OperandStack.SP)
+		require.Nil(t, vm.ActiveContext)
+		requireRun()
+	})
+
+	t.Run("host error", func(t *testing.T) {
+		failAt = 2
+		_, _, err := vm.ExecExportedFunction("run", 0)
+		require.True(t, errors.Is(err, errFailed))
+		failAt = -1
+		require.Equal(t, -1, vm.OperandStack.SP)
+		require.Nil(t, vm.ActiveContext)
+		requireRun()
+	})
+}
+
+func TestVirtualMachine_Call(t *testing.T) {
+	vm := &VirtualMachine{
+		InnerModule: &Module{
+			SecExports: map[string]*ExportSegment{
+				"a": {Desc: &ExportDesc{Index: 0, Kind: ExportKindFunction}},
+				"b": {Desc: &ExportDesc{Index: 0, Kind: ExportKindGlobal}},
+			},
+		},
+		Functions: []VirtualMachineFunction{&HostFunction{
+			function: reflect.ValueOf(func(a int32, b float64) (int32, float64) {
+				return a * 2, b / 2
+			}),
+			Signature: &FunctionType{
+				InputTypes:  []ValueType{ValueTypeI32, ValueTypeF64},
+				ReturnTypes: []ValueType{ValueTypeI32, ValueTypeF64},
+			},
+		}},
+		OperandStack: NewVirtualMachineOperandStack(),
+	}
+
+	ret, err := vm.Call("a", I32(-3), F64(5))
+	require.NoError(t, err)
+	require.Equal(t, []Value{I32(-6), F64(2.5)}, ret)
+
+	for _, args := range [][]Value{
+		{I32(1)},
+		{I64(1), F64(1)},
+		{I32(1), F32(1)},
+	} {
+		_, err = vm.Call("a", args...)
+		require.Error(t, err)
+	}
+	_, err = vm.Call("b")
+	require.Error(t, err)
+	require.Equal(t, -1, vm.OperandStack.SP)
+}
+
+func TestVirtualMachine_ExportedFunc(t *testing.T) {
+	vm := &VirtualMachine{
+		InnerModule: &Module{
+			SecExports: map[string]*ExportSegment{
+				"a": {Desc: &ExportDesc{Index: 0, Kind: ExportKindFunction}},
+			},
+		},
+		Functions: []VirtualMachineFunction{&HostFunction{
+			function: reflect.ValueOf(func(a int32, b float32) (int32, float64) {
+				return a * 2, float64(b) / 2
+			}),
+			Signature: &FunctionType{
+				InputTypes:  []ValueType{ValueTypeI32, ValueTypeF32},
+				ReturnTypes: []ValueType{ValueTypeI32, ValueTypeF64},
+			},
+		}},
+		OperandStack: NewVirtualMachineOperandStack(),
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		var f func(int32, float32) (int32, float64)
+		require.NoError(t, vm.ExportedFunc("a", &f))
+		a, b := f(-3, 5)
+		require.Equal(t, int32(-6), a)
+		require.Equal(t, 2.5, b)
+
+		var fe func(uint32, float32) (uint32, float64, error)
+		require.NoError(t, vm.ExportedFunc("a", &fe))
+		c, d, err := fe(3, 5)
+		require.NoError(t, err)
+		require.Equal(t, uint32(6), c)
+		require.Equal(t, 2.5, d)
+		require.Equal(t, -1, vm.OperandStack.SP)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		for _, fn := range []interface{}{
+			func(int32, float32) (int32, float64) { return 0, 0 },
+			new(int),
+			new(func(int32) (int32, float64)),
+			new(func(int32, float32) int32),
+			new(func(int64, float32) (int32, float64)),
+			new(func(int32, float32) (int32, float32)),
+			new(func(int32, string) (int32, float64)),
+		} {
+			err := vm.ExportedFunc("a", fn)
+			require.Error(t, err)
+			t.Log(err)
+		}
+		var f func()
+		require.Error(t, vm.ExportedFunc("b", &f))
+	})
+}
+
 func TestVirtualMachine_FetchInt32(t *testing.T) {
 	vm := &VirtualMachine{
 		ActiveContext: &NativeFunctionContext{
@@ -91,3 +287,82 @@ func TestVirtualMachine_FetchFloat64(t *testing.T) {
 	require.Equal(t, 3.1231231231, actual)
 	require.Equal(t, uint64(7), vm.ActiveContext.PC)
 }
+
+func TestNewVM_mutableGlobalImport(t *testing.T) {
+	shared := &Global{Type: &GlobalType{Value: ValueTypeI32, Mutable: true}, Val: 1}
+	externModules := map[string]*Module{
+		"env": {
+			SecExports: map[string]*ExportSegment{
+				"g": {Name: "g", Desc: &ExportDesc{Kind: ExportKindGlobal}},
+			},
+			IndexSpace: &ModuleIndexSpace{Globals: []*Global{shared}},
+		},
+	}
+
+	newImporter := func() *VirtualMachine {
+		m := &Module{
+			SecTypes: []*FunctionType{
+				{ReturnTypes: []ValueType{ValueTypeI32}},
+				{InputTypes: []ValueType{ValueTypeI32}},
+			},
+			SecImports: []*ImportSegment{{Module: "env", Name: "g", Desc: &ImportDesc{
+				Kind: ExportKindGlobal, GlobalTypePtr: &GlobalType{Value: ValueTypeI32, Mutable: true},
+			}}},
+			SecFunctions: []uint32{0, 1},
+			SecCodes: []*CodeSegment{
+				{Body: []byte{byte(OptCodeGlobalGet), 0x00}},
+				{Body: []byte{byte(OptCodeLocalGet), 0x00, byte(OptCodeGlobalSet), 0x00}},
+			},
+			SecMemory: []*MemoryType{{}},
+			SecExports: map[string]*ExportSegment{
+				"get": {Name: "get", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 0}},
+				"set": {Name: "set", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 1}},
+			},
+		}
+		vm, err := NewVM(m, externModules)
+		require.NoError(t, err)
+		return vm
+	}
+
+	vm1, vm2 := newImporter(), newImporter()
+
+	// write from the host
+	shared.Val = 42
+	for _, vm := range []*VirtualMachine{vm1, vm2} {
+		ret, _, err := vm.ExecExportedFunction("get")
+		require.NoError(t, err)
+		require.Equal(t, uint64(42), ret[0])
+	}
+
+	// write from one of the importers
+	_, _, err := vm1.ExecExportedFunction("set", 7)
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), shared.Val)
+	ret, _, err := vm2.ExecExportedFunction("get")
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), ret[0])
+}
+
+func TestNewVM_negativeI32Global(t *testing.T) {
+	m := &Module{
+		SecTypes: []*FunctionType{{ReturnTypes: []ValueType{ValueTypeI32}}},
+		SecGlobals: []*GlobalSegment{{
+			Type: &GlobalType{Value: ValueTypeI32},
+			Init: &ConstantExpression{data: []byte{byte(OptCodeI32Const), 0x7f}}, // -1
+		}},
+		SecFunctions: []uint32{0},
+		SecCodes: []*CodeSegment{{Body: []byte{
+			byte(OptCodeGlobalGet), 0x00, byte(OptCodeI32Const), 0x7f, byte(OptCodeI32eq),
+		}}},
+		SecMemory: []*MemoryType{{}},
+		SecExports: map[string]*ExportSegment{
+			"eq": {Name: "eq", Desc: &ExportDesc{Kind: ExportKindFunction, Index: 0}},
+		},
+	}
+	vm, err := NewVM(m, nil)
+	require.NoError(t, err)
+
+	ret, _, err := vm.ExecExportedFunction("eq")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), ret[0])
+}